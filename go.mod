@@ -3,13 +3,18 @@ module github.com/itchio/lake
 go 1.13
 
 require (
+	github.com/andybalholm/brotli v1.0.0
 	github.com/golang/protobuf v1.3.4
 	github.com/itchio/arkive v0.0.0-20200301155608-aeded25a0494
 	github.com/itchio/headway v0.0.0-20200301160421-e15721f23905
 	github.com/itchio/httpkit v0.0.0-20200301151414-2207154e44d1
 	github.com/itchio/screw v0.0.0-20200301160148-75fc2d65fb38
+	github.com/klauspost/compress v1.10.2
 	github.com/mitchellh/copystructure v1.0.0
 	github.com/mitchellh/reflectwalk v1.0.1 // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.5.1
+	golang.org/x/sys v0.0.0-20200301153931-2f85c7ec1e52
+	golang.org/x/text v0.3.2
+	gopkg.in/yaml.v2 v2.2.8
 )
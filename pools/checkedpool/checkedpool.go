@@ -0,0 +1,176 @@
+package checkedpool
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/itchio/lake"
+	"github.com/itchio/lake/tlc"
+	"github.com/pkg/errors"
+)
+
+// A CheckedPool wraps a WritablePool and makes sure every file of the
+// container is written exactly once, with exactly the size the container
+// specifies.
+//
+// Writers returned by GetWriter error out as soon as more bytes than
+// expected are written, and their Close reports short writes. Closing
+// the pool itself fails if any file was never written, or written more
+// than once.
+type CheckedPool struct {
+	container *tlc.Container
+	pool      lake.WritablePool
+
+	writeCounts []int
+	mutex       sync.Mutex
+}
+
+var _ lake.WritablePool = (*CheckedPool)(nil)
+
+// New creates a CheckedPool that forwards all calls to pool, validating
+// writes against the given container.
+func New(container *tlc.Container, pool lake.WritablePool) *CheckedPool {
+	return &CheckedPool{
+		container:   container,
+		pool:        pool,
+		writeCounts: make([]int, len(container.Files)),
+	}
+}
+
+// GetSize returns the size of the file at index fileIndex
+func (cp *CheckedPool) GetSize(fileIndex int64) int64 {
+	return cp.pool.GetSize(fileIndex)
+}
+
+// GetReader forwards to the underlying pool
+func (cp *CheckedPool) GetReader(fileIndex int64) (io.Reader, error) {
+	return cp.pool.GetReader(fileIndex)
+}
+
+// GetReadSeeker forwards to the underlying pool
+func (cp *CheckedPool) GetReadSeeker(fileIndex int64) (io.ReadSeeker, error) {
+	return cp.pool.GetReadSeeker(fileIndex)
+}
+
+// GetWriter returns a writer for the given file that refuses to write
+// past the file's size, and errors on Close if fewer bytes were written.
+func (cp *CheckedPool) GetWriter(fileIndex int64) (io.WriteCloser, error) {
+	if fileIndex < 0 || fileIndex >= int64(len(cp.container.Files)) {
+		return nil, errors.Errorf("checkedpool: file index %d out of range (container has %d files)", fileIndex, len(cp.container.Files))
+	}
+
+	w, err := cp.pool.GetWriter(fileIndex)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &checkedWriter{
+		pool:      cp,
+		fileIndex: fileIndex,
+		file:      cp.container.Files[fileIndex],
+		writer:    w,
+	}, nil
+}
+
+// Close closes the underlying pool, then verifies that all files were
+// written exactly once. If not, it returns an error listing the
+// offending files.
+func (cp *CheckedPool) Close() error {
+	err := cp.pool.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return cp.Check()
+}
+
+// Check returns an error listing all files that have not been written
+// exactly once so far.
+func (cp *CheckedPool) Check() error {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	var missing []string
+	var duplicate []string
+	for i, count := range cp.writeCounts {
+		f := cp.container.Files[i]
+		switch {
+		case count == 0:
+			missing = append(missing, fmt.Sprintf("  - %s", f.Path))
+		case count > 1:
+			duplicate = append(duplicate, fmt.Sprintf("  - %s (%d times)", f.Path, count))
+		}
+	}
+
+	if len(missing) == 0 && len(duplicate) == 0 {
+		return nil
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("%d files were never written:\n%s", len(missing), strings.Join(missing, "\n")))
+	}
+	if len(duplicate) > 0 {
+		problems = append(problems, fmt.Sprintf("%d files were written more than once:\n%s", len(duplicate), strings.Join(duplicate, "\n")))
+	}
+	return errors.New("Incomplete pool, found the following problems:\n" + strings.Join(problems, "\n"))
+}
+
+func (cp *CheckedPool) markWritten(fileIndex int64) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	cp.writeCounts[fileIndex]++
+}
+
+// checkedWriter
+
+type checkedWriter struct {
+	pool      *CheckedPool
+	fileIndex int64
+	file      *tlc.File
+	writer    io.WriteCloser
+
+	written int64
+	failed  bool
+}
+
+var _ io.WriteCloser = (*checkedWriter)(nil)
+
+func (cw *checkedWriter) Write(data []byte) (int, error) {
+	if cw.written+int64(len(data)) > cw.file.Size {
+		cw.failed = true
+		return 0, errors.Errorf("%s: overrun, writing %d bytes at offset %d would exceed expected size %d",
+			cw.file.Path, len(data), cw.written, cw.file.Size)
+	}
+
+	n, err := cw.writer.Write(data)
+	cw.written += int64(n)
+	if err != nil {
+		cw.failed = true
+	}
+	return n, err
+}
+
+// Close closes the underlying writer, and reports an error if
+// fewer bytes than expected were written. Files whose writers
+// close successfully are counted as written.
+func (cw *checkedWriter) Close() error {
+	err := cw.writer.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if cw.failed {
+		return errors.Errorf("%s: an earlier write failed", cw.file.Path)
+	}
+
+	if cw.written < cw.file.Size {
+		return errors.Errorf("%s: underrun, wrote %d bytes but expected %d", cw.file.Path, cw.written, cw.file.Size)
+	}
+
+	cw.pool.markWritten(cw.fileIndex)
+	return nil
+}
@@ -0,0 +1,83 @@
+package checkedpool_test
+
+import (
+	"testing"
+
+	"github.com/itchio/lake/pools/checkedpool"
+	"github.com/itchio/lake/pools/nullpool"
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CheckedPool(t *testing.T) {
+	assert := assert.New(t)
+
+	container := &tlc.Container{
+		Files: []*tlc.File{
+			&tlc.File{Path: "a", Mode: 0o644, Size: 4, Offset: 0},
+			&tlc.File{Path: "b", Mode: 0o644, Size: 2, Offset: 4},
+			&tlc.File{Path: "c", Mode: 0o644, Size: 0, Offset: 6},
+		},
+		Size: 6,
+	}
+
+	cp := checkedpool.New(container, nullpool.New(container))
+
+	// overrun
+	w, err := cp.GetWriter(0)
+	must(t, err)
+	_, err = w.Write([]byte("abc"))
+	must(t, err)
+	_, err = w.Write([]byte("de"))
+	assert.Error(err, "should refuse to write past file size")
+	assert.Error(w.Close(), "a failed writer should not count as written")
+
+	// underrun
+	w, err = cp.GetWriter(0)
+	must(t, err)
+	_, err = w.Write([]byte("abc"))
+	must(t, err)
+	assert.Error(w.Close(), "should report short writes")
+
+	// just right
+	w, err = cp.GetWriter(0)
+	must(t, err)
+	_, err = w.Write([]byte("abcd"))
+	must(t, err)
+	must(t, w.Close())
+
+	// written twice
+	for i := 0; i < 2; i++ {
+		w, err = cp.GetWriter(1)
+		must(t, err)
+		_, err = w.Write([]byte("ef"))
+		must(t, err)
+		must(t, w.Close())
+	}
+
+	_, err = cp.GetWriter(3)
+	assert.Error(err, "should refuse out-of-range indices")
+
+	err = cp.Close()
+	assert.Error(err)
+	assert.Contains(err.Error(), "never written:\n  - c")
+	assert.Contains(err.Error(), "more than once:\n  - b (2 times)")
+	t.Logf("As expected:\n%s", err)
+
+	cp = checkedpool.New(container, nullpool.New(container))
+	for i, f := range container.Files {
+		w, err := cp.GetWriter(int64(i))
+		must(t, err)
+		_, err = w.Write(make([]byte, f.Size))
+		must(t, err)
+		must(t, w.Close())
+	}
+	assert.NoError(cp.Close())
+}
+
+func must(t *testing.T, err error) {
+	if err != nil {
+		t.Error("must failed: ", err.Error())
+		t.FailNow()
+	}
+}
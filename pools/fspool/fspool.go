@@ -6,6 +6,7 @@ import (
 	"path"
 	"path/filepath"
 	"sort"
+	"sync"
 
 	"github.com/itchio/lake"
 	"github.com/itchio/lake/tlc"
@@ -32,6 +33,20 @@ type FsPool struct {
 	reader    fsEntryReader
 
 	UniqueReader fsEntryReader
+
+	// SymlinkPolicy decides what GetWriter does when one of the parents of
+	// the file being written is a symlink on disk that leads outside of the
+	// base path. SymlinkPolicyAllow writes through it, SymlinkPolicyMaterialize
+	// replaces it with a regular directory, and any other policy errors out.
+	SymlinkPolicy tlc.SymlinkPolicy
+
+	// Metadata selects which extended metadata of the container files
+	// get restored when writers returned by GetWriter are closed.
+	Metadata tlc.MetadataOpts
+
+	// hardlinks is built once, since GetWriter can be called concurrently
+	hardlinks     map[string][]*tlc.Hardlink
+	hardlinksOnce sync.Once
 }
 
 var _ lake.Pool = (*FsPool)(nil)
@@ -69,9 +84,10 @@ func (cfp *FsPool) GetRelativePath(fileIndex int64) string {
 }
 
 // GetPath returns the native path of a file (with slashes or backslashes)
-// on-disk, based on the FsPool's base path
+// on-disk, based on the FsPool's base path. If the file's path was normalized
+// when walking, this is the path it was originally found at.
 func (cfp *FsPool) GetPath(fileIndex int64) string {
-	return cfp.diskPath(cfp.GetRelativePath(fileIndex))
+	return cfp.diskPath(cfp.container.Files[fileIndex].SourcePath())
 }
 
 func (cfp *FsPool) diskPath(containerPath string) string {
@@ -112,6 +128,10 @@ func (cfp *FsPool) GetReadSeeker(fileIndex int64) (io.ReadSeeker, error) {
 		}
 
 		reader, err := screw.Open(cfp.GetPath(fileIndex))
+		if err != nil && os.IsNotExist(err) && cfp.container.Files[fileIndex].OriginalPath != "" {
+			// the file may have been written by us, at its normalized path
+			reader, err = screw.Open(cfp.diskPath(cfp.GetRelativePath(fileIndex)))
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -140,10 +160,25 @@ func (cfp *FsPool) Close() error {
 
 // GetWriter returns a writer for one of the container's file.
 // It creates the file if it doesn't exist, and always truncates it.
+// Hardlinks to the file are recreated when the writer is closed.
+// It refuses to write files whose path is unsafe (see tlc.ValidatePath).
 func (cfp *FsPool) GetWriter(fileIndex int64) (io.WriteCloser, error) {
-	path := cfp.GetPath(fileIndex)
+	relPath := cfp.GetRelativePath(fileIndex)
+	err := tlc.ValidatePath(relPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if cfp.SymlinkPolicy != tlc.SymlinkPolicyAllow {
+		err := cfp.checkSymlinkEscape(relPath)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	path := cfp.diskPath(relPath)
 
-	err := screw.MkdirAll(filepath.Dir(path), os.FileMode(0o755))
+	err = screw.MkdirAll(filepath.Dir(path), os.FileMode(0o755))
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -156,7 +191,9 @@ func (cfp *FsPool) GetWriter(fileIndex int64) (io.WriteCloser, error) {
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
-		} else if stats.Mode()&os.ModeSymlink > 0 {
+		} else if stats.Mode()&os.ModeSymlink > 0 || tlc.HasHardlinks(stats) {
+			// don't write through symlinks, or into files that
+			// other paths share (hardlinks get recreated on Close)
 			err := screw.Remove(path)
 			if err != nil {
 				return nil, errors.WithStack(err)
@@ -170,9 +207,114 @@ func (cfp *FsPool) GetWriter(fileIndex int64) (io.WriteCloser, error) {
 		return nil, oErr
 	}
 
+	hardlinks := cfp.hardlinksTo(outputFile.Path)
+	if outputFile.Metadata != nil || len(hardlinks) > 0 {
+		return &fileWriter{File: f, pool: cfp, path: path, file: outputFile, hardlinks: hardlinks}, nil
+	}
 	return f, nil
 }
 
+// hardlinksTo returns all hardlinks of the container whose target is p
+func (cfp *FsPool) hardlinksTo(p string) []*tlc.Hardlink {
+	if len(cfp.container.Hardlinks) == 0 {
+		return nil
+	}
+
+	cfp.hardlinksOnce.Do(func() {
+		cfp.hardlinks = make(map[string][]*tlc.Hardlink)
+		for _, h := range cfp.container.Hardlinks {
+			cfp.hardlinks[h.Target] = append(cfp.hardlinks[h.Target], h)
+		}
+	})
+	return cfp.hardlinks[p]
+}
+
+// fileWriter restores a file's metadata and recreates
+// hardlinks to it after it's done being written
+type fileWriter struct {
+	*os.File
+	pool      *FsPool
+	path      string
+	file      *tlc.File
+	hardlinks []*tlc.Hardlink
+}
+
+func (fw *fileWriter) Close() error {
+	err := fw.File.Close()
+	if err != nil {
+		return err
+	}
+
+	err = tlc.ApplyMetadata(fw.path, fw.file.Metadata, fw.pool.Metadata)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, h := range fw.hardlinks {
+		err := fw.pool.writeHardlink(h)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func (cfp *FsPool) writeHardlink(h *tlc.Hardlink) error {
+	err := tlc.ValidatePath(h.Path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if cfp.SymlinkPolicy != tlc.SymlinkPolicyAllow {
+		err := cfp.checkSymlinkEscape(h.Path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	linkPath := cfp.diskPath(h.Path)
+	err = screw.MkdirAll(filepath.Dir(linkPath), os.FileMode(0o755))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = screw.RemoveAll(linkPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = os.Link(cfp.diskPath(h.Target), linkPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (cfp *FsPool) checkSymlinkEscape(relPath string) error {
+	escape, err := tlc.FindSymlinkEscape(cfp.basePath, path.Dir(relPath))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if escape == "" {
+		return nil
+	}
+
+	if cfp.SymlinkPolicy == tlc.SymlinkPolicyMaterialize {
+		// remove the link itself, the directory will be
+		// created by GetWriter
+		err := screw.Remove(escape)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+
+	return errors.Errorf("refusing to write (%s): (%s) is a symlink leading outside of (%s)", relPath, escape, cfp.basePath)
+}
+
 func (cfp *FsPool) FixExistingCase(params lake.CaseFixParams) error {
 	if !screw.IsCaseInsensitiveFS() {
 		return nil
@@ -1,9 +1,12 @@
 package fspool_test
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
 
 	"github.com/itchio/headway/state"
@@ -119,6 +122,173 @@ func Test_FixExistingCase_Substrings(t *testing.T) {
 	}
 }
 
+func Test_GetWriterUnsafePath(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "")
+	must(t, err)
+	defer os.RemoveAll(tempDir)
+
+	container := &tlc.Container{
+		Files: []*tlc.File{
+			&tlc.File{Path: "../escaped", Mode: 0o644, Size: 4},
+		},
+	}
+
+	fsp := fspool.New(container, filepath.Join(tempDir, "base"))
+	_, err = fsp.GetWriter(0)
+	assert.Error(err, "should refuse to write outside base path")
+
+	_, err = os.Lstat(filepath.Join(tempDir, "escaped"))
+	assert.True(os.IsNotExist(err))
+}
+
+func Test_GetWriterSymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not tested on windows")
+	}
+
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "")
+	must(t, err)
+	defer os.RemoveAll(tempDir)
+
+	outside := filepath.Join(tempDir, "outside")
+	must(t, os.MkdirAll(outside, 0o755))
+	basePath := filepath.Join(tempDir, "base")
+	must(t, os.MkdirAll(basePath, 0o755))
+	must(t, os.Symlink(outside, filepath.Join(basePath, "data")))
+
+	container := &tlc.Container{
+		Files: []*tlc.File{
+			&tlc.File{Path: "data/file", Mode: 0o644, Size: 4},
+		},
+	}
+
+	fsp := fspool.New(container, basePath)
+	fsp.SymlinkPolicy = tlc.SymlinkPolicyReject
+	_, err = fsp.GetWriter(0)
+	assert.Error(err, "should refuse to write through escaping symlink")
+
+	fsp.SymlinkPolicy = tlc.SymlinkPolicyMaterialize
+	w, err := fsp.GetWriter(0)
+	must(t, err)
+	_, err = w.Write([]byte("data"))
+	must(t, err)
+	must(t, w.Close())
+
+	stats, err := os.Lstat(filepath.Join(basePath, "data"))
+	must(t, err)
+	assert.True(stats.IsDir(), "escaping symlink should have been replaced with a directory")
+
+	_, err = os.Lstat(filepath.Join(outside, "file"))
+	assert.True(os.IsNotExist(err), "should not have written outside base path")
+}
+
+func Test_GetWriterConcurrentHardlinks(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "")
+	must(t, err)
+	defer os.RemoveAll(tempDir)
+
+	container := &tlc.Container{}
+	for i := 0; i < 32; i++ {
+		name := fmt.Sprintf("file%d", i)
+		container.Files = append(container.Files, &tlc.File{Path: name, Mode: 0o644, Size: 4})
+		container.Hardlinks = append(container.Hardlinks, &tlc.Hardlink{Path: name + ".link", Target: name})
+	}
+
+	fsp := fspool.New(container, tempDir)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make([]error, len(container.Files))
+	for i := range container.Files {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			w, err := fsp.GetWriter(int64(i))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			_, err = w.Write([]byte("data"))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = w.Close()
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i, f := range container.Files {
+		must(t, errs[i])
+		contents, err := ioutil.ReadFile(filepath.Join(tempDir, f.Path+".link"))
+		must(t, err)
+		assert.EqualValues("data", string(contents))
+	}
+}
+
+func Test_NormalizedPaths(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("macOS filesystems normalize paths themselves")
+	}
+
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "")
+	must(t, err)
+	defer os.RemoveAll(tempDir)
+
+	nfd := "cafe\u0301"
+	nfc := "caf\u00e9"
+
+	src := filepath.Join(tempDir, "src")
+	must(t, os.MkdirAll(filepath.Join(src, nfd), 0o755))
+	must(t, ioutil.WriteFile(filepath.Join(src, nfd, "menu.txt"), []byte("espresso"), 0o644))
+
+	container, err := tlc.WalkDir(src, tlc.WalkOpts{NormalizeUnicode: true})
+	must(t, err)
+
+	assert.EqualValues(nfc, container.Dirs[0].Path)
+	assert.EqualValues(nfc+"/menu.txt", container.Files[0].Path)
+	assert.EqualValues(nfd+"/menu.txt", container.Files[0].OriginalPath)
+
+	// reading finds files at their original path
+	srcPool := fspool.New(container, src)
+	r, err := srcPool.GetReader(0)
+	must(t, err)
+	contents, err := ioutil.ReadAll(r)
+	must(t, err)
+	assert.EqualValues("espresso", string(contents))
+	must(t, srcPool.Close())
+
+	// writing uses the normalized path
+	dst := filepath.Join(tempDir, "dst")
+	dstPool := fspool.New(container, dst)
+	w, err := dstPool.GetWriter(0)
+	must(t, err)
+	_, err = w.Write(contents)
+	must(t, err)
+	must(t, w.Close())
+
+	_, err = os.Stat(filepath.Join(dst, nfc, "menu.txt"))
+	assert.NoError(err)
+
+	// and reading falls back to the normalized path
+	r, err = dstPool.GetReader(0)
+	must(t, err)
+	contents, err = ioutil.ReadAll(r)
+	must(t, err)
+	assert.EqualValues("espresso", string(contents))
+	must(t, dstPool.Close())
+}
+
 func must(t *testing.T, err error) {
 	if err != nil {
 		assert.NoError(t, err)
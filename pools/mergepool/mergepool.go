@@ -0,0 +1,101 @@
+package mergepool
+
+import (
+	"io"
+
+	"github.com/itchio/lake"
+	"github.com/itchio/lake/tlc"
+	"github.com/pkg/errors"
+)
+
+// A MergePool reads the files of a merged container (see tlc.Container.Merge)
+// from the pools of the layers it was merged from. It is not writable.
+type MergePool struct {
+	container *tlc.Container
+	sources   tlc.SourceMap
+	layers    []lake.Pool
+
+	// the layer we last read from
+	lastLayer int
+}
+
+var _ lake.Pool = (*MergePool)(nil)
+
+// New creates a MergePool for a merged container. layers must hold the pool
+// of each layer, in the same order they were given to Merge, with the
+// pool of the bottom container first.
+func New(container *tlc.Container, sources tlc.SourceMap, layers ...lake.Pool) (*MergePool, error) {
+	if len(sources) != len(container.Files) {
+		return nil, errors.Errorf("source map has %d entries, but merged container has %d files", len(sources), len(container.Files))
+	}
+	for _, source := range sources {
+		if source.Layer < 0 || source.Layer >= len(layers) {
+			return nil, errors.Errorf("source map refers to layer %d, but only %d pools were given", source.Layer, len(layers))
+		}
+	}
+
+	return &MergePool{
+		container: container,
+		sources:   sources,
+		layers:    layers,
+		lastLayer: -1,
+	}, nil
+}
+
+// GetSize returns the size of the file at index fileIndex
+func (mp *MergePool) GetSize(fileIndex int64) int64 {
+	return mp.container.Files[fileIndex].Size
+}
+
+// GetReader returns a reader for the file at index fileIndex, from
+// the pool of the layer it comes from.
+func (mp *MergePool) GetReader(fileIndex int64) (io.Reader, error) {
+	pool, layerIndex, err := mp.source(fileIndex)
+	if err != nil {
+		return nil, err
+	}
+	return pool.GetReader(layerIndex)
+}
+
+// GetReadSeeker is like GetReader, but the returned reader can seek
+func (mp *MergePool) GetReadSeeker(fileIndex int64) (io.ReadSeeker, error) {
+	pool, layerIndex, err := mp.source(fileIndex)
+	if err != nil {
+		return nil, err
+	}
+	return pool.GetReadSeeker(layerIndex)
+}
+
+// source returns the pool and file index to read a merged file from.
+// Since pools cache their last reader, switching to another layer
+// closes the reader of the previous one.
+func (mp *MergePool) source(fileIndex int64) (lake.Pool, int64, error) {
+	if fileIndex < 0 || fileIndex >= int64(len(mp.sources)) {
+		return nil, 0, errors.Errorf("mergepool: invalid file index %d", fileIndex)
+	}
+	source := mp.sources[fileIndex]
+
+	if mp.lastLayer != -1 && mp.lastLayer != source.Layer {
+		err := mp.layers[mp.lastLayer].Close()
+		if err != nil {
+			return nil, 0, errors.WithStack(err)
+		}
+	}
+	mp.lastLayer = source.Layer
+
+	return mp.layers[source.Layer], source.FileIndex, nil
+}
+
+// Close closes all underlying pools, and returns the first
+// error encountered, if any.
+func (mp *MergePool) Close() error {
+	var firstErr error
+	for _, pool := range mp.layers {
+		err := pool.Close()
+		if err != nil && firstErr == nil {
+			firstErr = errors.WithStack(err)
+		}
+	}
+	mp.lastLayer = -1
+	return firstErr
+}
@@ -0,0 +1,74 @@
+package mergepool_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itchio/lake/pools/fspool"
+	"github.com/itchio/lake/pools/mergepool"
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MergePool(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_mergepool")
+	must(t, err)
+	defer os.RemoveAll(tmpPath)
+
+	write := func(layer string, name string, contents string) {
+		p := filepath.Join(tmpPath, layer, name)
+		must(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		must(t, ioutil.WriteFile(p, []byte(contents), 0o644))
+	}
+	write("base", "data/a.txt", "base a")
+	write("base", "data/b.txt", "base b")
+	write("dlc", "data/b.txt", "dlc b")
+	write("dlc", "data/c.txt", "dlc c")
+
+	baseContainer, err := tlc.WalkDir(filepath.Join(tmpPath, "base"), tlc.WalkOpts{})
+	must(t, err)
+	dlcContainer, err := tlc.WalkDir(filepath.Join(tmpPath, "dlc"), tlc.WalkOpts{})
+	must(t, err)
+
+	merged, sources, err := baseContainer.Merge(tlc.MergeOpts{Policy: tlc.MergeLastWins}, dlcContainer)
+	must(t, err)
+
+	_, err = mergepool.New(merged, sources[1:], fspool.New(baseContainer, filepath.Join(tmpPath, "base")))
+	assert.Error(err)
+	_, err = mergepool.New(merged, sources, fspool.New(baseContainer, filepath.Join(tmpPath, "base")))
+	assert.Error(err)
+
+	mp, err := mergepool.New(merged, sources,
+		fspool.New(baseContainer, filepath.Join(tmpPath, "base")),
+		fspool.New(dlcContainer, filepath.Join(tmpPath, "dlc")),
+	)
+	must(t, err)
+	defer mp.Close()
+
+	expected := map[string]string{
+		"data/a.txt": "base a",
+		"data/b.txt": "dlc b",
+		"data/c.txt": "dlc c",
+	}
+	assert.Len(merged.Files, len(expected))
+	for i, f := range merged.Files {
+		assert.EqualValues(len(expected[f.Path]), mp.GetSize(int64(i)))
+
+		r, err := mp.GetReader(int64(i))
+		must(t, err)
+		contents, err := ioutil.ReadAll(r)
+		must(t, err)
+		assert.EqualValues(expected[f.Path], string(contents), f.Path)
+	}
+}
+
+func must(t *testing.T, err error) {
+	if err != nil {
+		t.Error("must failed: ", err.Error())
+		t.FailNow()
+	}
+}
@@ -0,0 +1,110 @@
+package teepool
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/itchio/lake"
+	"github.com/itchio/lake/tlc"
+	"github.com/pkg/errors"
+)
+
+// A TeePool forwards writes to several underlying writable pools,
+// for example an fspool (to install a build) and a zipwriterpool
+// (to archive it at the same time), so the source only has to be read once.
+// It is not readable.
+type TeePool struct {
+	container *tlc.Container
+	pools     []lake.WritablePool
+}
+
+var _ lake.WritablePool = (*TeePool)(nil)
+
+// New creates a TeePool that fans out writes to all the given pools.
+// All pools must have been built with the same container.
+func New(container *tlc.Container, pools ...lake.WritablePool) *TeePool {
+	return &TeePool{
+		container: container,
+		pools:     pools,
+	}
+}
+
+// GetSize returns the size of the file at index fileIndex
+func (tp *TeePool) GetSize(fileIndex int64) int64 {
+	return tp.container.Files[fileIndex].Size
+}
+
+func (tp *TeePool) GetReader(fileIndex int64) (io.Reader, error) {
+	return nil, fmt.Errorf("teepool is not readable")
+}
+
+func (tp *TeePool) GetReadSeeker(fileIndex int64) (io.ReadSeeker, error) {
+	return nil, fmt.Errorf("teepool is not readable")
+}
+
+// GetWriter returns a writer that forwards everything written to it
+// to a writer from each of the underlying pools. If any of the pools
+// fails to return a writer, those already opened are closed.
+func (tp *TeePool) GetWriter(fileIndex int64) (io.WriteCloser, error) {
+	var writers []io.WriteCloser
+
+	for _, pool := range tp.pools {
+		w, err := pool.GetWriter(fileIndex)
+		if err != nil {
+			for _, ow := range writers {
+				ow.Close()
+			}
+			return nil, errors.WithStack(err)
+		}
+		writers = append(writers, w)
+	}
+
+	return &teeWriteCloser{writers}, nil
+}
+
+// Close closes all underlying pools, and returns the first
+// error encountered, if any.
+func (tp *TeePool) Close() error {
+	var firstErr error
+	for _, pool := range tp.pools {
+		err := pool.Close()
+		if err != nil && firstErr == nil {
+			firstErr = errors.WithStack(err)
+		}
+	}
+	return firstErr
+}
+
+// teeWriteCloser
+
+type teeWriteCloser struct {
+	writers []io.WriteCloser
+}
+
+var _ io.WriteCloser = (*teeWriteCloser)(nil)
+
+func (twc *teeWriteCloser) Write(data []byte) (int, error) {
+	for _, w := range twc.writers {
+		n, err := w.Write(data)
+		if err != nil {
+			return n, err
+		}
+		if n != len(data) {
+			return n, io.ErrShortWrite
+		}
+	}
+	return len(data), nil
+}
+
+// Close closes all writers, even if some of them fail,
+// and returns the first error encountered.
+func (twc *teeWriteCloser) Close() error {
+	var firstErr error
+	for _, w := range twc.writers {
+		err := w.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,121 @@
+package teepool_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+	"github.com/itchio/lake"
+	"github.com/itchio/lake/pools/fspool"
+	"github.com/itchio/lake/pools/nullpool"
+	"github.com/itchio/lake/pools/teepool"
+	"github.com/itchio/lake/pools/zippool"
+	"github.com/itchio/lake/pools/zipwriterpool"
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TeePool(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_teepool")
+	must(t, err)
+	defer os.RemoveAll(tmpPath)
+
+	contents := []byte("Hello!")
+	container := &tlc.Container{
+		Dirs: []*tlc.Dir{
+			&tlc.Dir{Path: "sub", Mode: 0o755 | uint32(os.ModeDir)},
+		},
+		Files: []*tlc.File{
+			&tlc.File{Path: "sub/hello.txt", Mode: 0o644, Size: int64(len(contents))},
+		},
+		Size: int64(len(contents)),
+	}
+
+	installPath := filepath.Join(tmpPath, "install")
+	fsp := fspool.New(container, installPath)
+
+	zipBuf := new(bytes.Buffer)
+	zwp, err := zipwriterpool.New(container, zip.NewWriter(zipBuf))
+	must(t, err)
+
+	tp := teepool.New(container, fsp, zwp)
+	assert.EqualValues(len(contents), tp.GetSize(0))
+
+	_, err = tp.GetReader(0)
+	assert.Error(err, "teepool should not be readable")
+
+	w, err := tp.GetWriter(0)
+	must(t, err)
+	_, err = w.Write(contents)
+	must(t, err)
+	must(t, w.Close())
+	must(t, tp.Close())
+
+	installed, err := ioutil.ReadFile(filepath.Join(installPath, "sub", "hello.txt"))
+	must(t, err)
+	assert.EqualValues(contents, installed)
+
+	zr, err := zip.NewReader(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()))
+	must(t, err)
+	zp := zippool.New(container, zr)
+	r, err := zp.GetReader(0)
+	must(t, err)
+	archived, err := ioutil.ReadAll(r)
+	must(t, err)
+	assert.EqualValues(contents, archived)
+}
+
+func Test_TeePoolErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	container := &tlc.Container{
+		Files: []*tlc.File{
+			&tlc.File{Path: "a", Mode: 0o644, Size: 4},
+		},
+		Size: 4,
+	}
+
+	writeErr := errors.New("disk on fire")
+	tp := teepool.New(container, nullpool.New(container), &failingPool{nullpool.New(container), writeErr})
+
+	w, err := tp.GetWriter(0)
+	must(t, err)
+	_, err = w.Write([]byte("abcd"))
+	assert.Equal(writeErr, err)
+	assert.Equal(writeErr, w.Close())
+}
+
+type failingPool struct {
+	lake.WritablePool
+	err error
+}
+
+func (fp *failingPool) GetWriter(fileIndex int64) (io.WriteCloser, error) {
+	return &failingWriter{fp.err}, nil
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (fw *failingWriter) Write(data []byte) (int, error) {
+	return 0, fw.err
+}
+
+func (fw *failingWriter) Close() error {
+	return fw.err
+}
+
+func must(t *testing.T, err error) {
+	if err != nil {
+		t.Error("must failed: ", err.Error())
+		t.FailNow()
+	}
+}
@@ -99,7 +99,7 @@ func (cfp *ZipPool) GetReader(fileIndex int64) (io.Reader, error) {
 			cfp.fileIndex = -1
 		}
 
-		relPath := cfp.GetRelativePath(fileIndex)
+		relPath := cfp.container.Files[fileIndex].SourcePath()
 		f := cfp.fmap[relPath]
 		if f == nil {
 			if verboseZipPool {
@@ -136,7 +136,7 @@ func (cfp *ZipPool) GetReadSeeker(fileIndex int64) (io.ReadSeeker, error) {
 			cfp.seekFileIndex = -1
 		}
 
-		key := cfp.GetRelativePath(fileIndex)
+		key := cfp.container.Files[fileIndex].SourcePath()
 		f := cfp.fmap[key]
 		if f == nil {
 			return nil, errors.WithStack(os.ErrNotExist)
@@ -3,6 +3,7 @@ package zipwriterpool
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"time"
 
@@ -15,9 +16,12 @@ import (
 
 // A ZipWriterPool writes a pool to a .zip file, given a container.
 // It first writes the dirs, then all the files, then the symlinks.
+// Zip files can't store hardlinks, so they're written as copies
+// of their target, right after it.
 type ZipWriterPool struct {
 	container *tlc.Container
 	zw        *zip.Writer
+	hardlinks map[string][]*tlc.Hardlink
 }
 
 var _ lake.WritablePool = (*ZipWriterPool)(nil)
@@ -26,6 +30,11 @@ func New(container *tlc.Container, zw *zip.Writer) (*ZipWriterPool, error) {
 	zwp := &ZipWriterPool{
 		container: container,
 		zw:        zw,
+		hardlinks: make(map[string][]*tlc.Hardlink),
+	}
+
+	for _, h := range container.Hardlinks {
+		zwp.hardlinks[h.Target] = append(zwp.hardlinks[h.Target], h)
 	}
 
 	err := zwp.writeDirs()
@@ -42,7 +51,7 @@ func (zwp *ZipWriterPool) writeDirs() error {
 			Name: dir.Path + "/",
 		}
 		fh.SetMode(os.FileMode(dir.Mode))
-		fh.Modified = time.Now()
+		setMetadata(&fh, dir.Metadata)
 
 		_, err := zwp.zw.CreateHeader(&fh)
 		if err != nil {
@@ -59,6 +68,7 @@ func (zwp *ZipWriterPool) writeSymlinks() error {
 			Name: symlink.Path,
 		}
 		fh.SetMode(os.FileMode(symlink.Mode))
+		setMetadata(&fh, symlink.Metadata)
 
 		entryWriter, err := zwp.zw.CreateHeader(&fh)
 		if err != nil {
@@ -95,13 +105,30 @@ func (zwp *ZipWriterPool) GetWriter(fileIndex int64) (io.WriteCloser, error) {
 		Method:             zip.Deflate,
 	}
 	fh.SetMode(os.FileMode(file.Mode))
-	fh.Modified = time.Now()
+	setMetadata(&fh, file.Metadata)
 
 	w, err := zwp.zw.CreateHeader(&fh)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
+	if hardlinks := zwp.hardlinks[file.Path]; len(hardlinks) > 0 {
+		// zip.Writer only writes one entry at a time, so keep
+		// the contents around until the copies can be written
+		spool, err := ioutil.TempFile("", "zipwriterpool-hardlink")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return &hardlinkWriter{
+			zwp:       zwp,
+			file:      file,
+			writer:    io.MultiWriter(w, spool),
+			spool:     spool,
+			hardlinks: hardlinks,
+		}, nil
+	}
+
 	return &nopWriteCloser{w}, nil
 }
 
@@ -121,6 +148,69 @@ func (zwp *ZipWriterPool) Close() error {
 	return nil
 }
 
+// setMetadata stores an entry's modification time (or the current time,
+// if it's unknown) and ownership in a zip file header. Zip files have
+// no standard way to store extended attributes, so they're lost.
+func setMetadata(fh *zip.FileHeader, m *tlc.Metadata) {
+	if mtime, ok := m.ModTime(); ok {
+		fh.Modified = mtime
+	} else {
+		fh.Modified = time.Now()
+	}
+
+	if owner := m.GetOwner(); owner != nil {
+		fh.Extra = append(fh.Extra, tlc.ZipOwnershipExtra(owner)...)
+	}
+}
+
+// hardlinkWriter writes copies of a file for all hardlinks to it
+
+type hardlinkWriter struct {
+	zwp       *ZipWriterPool
+	file      *tlc.File
+	writer    io.Writer
+	spool     *os.File
+	hardlinks []*tlc.Hardlink
+}
+
+var _ io.WriteCloser = (*hardlinkWriter)(nil)
+
+func (hw *hardlinkWriter) Write(data []byte) (int, error) {
+	return hw.writer.Write(data)
+}
+
+func (hw *hardlinkWriter) Close() error {
+	defer os.Remove(hw.spool.Name())
+	defer hw.spool.Close()
+
+	for _, h := range hw.hardlinks {
+		fh := zip.FileHeader{
+			Name:               h.Path,
+			UncompressedSize64: uint64(hw.file.Size),
+			Method:             zip.Deflate,
+		}
+		fh.SetMode(os.FileMode(h.Mode))
+		setMetadata(&fh, h.Metadata)
+
+		w, err := hw.zwp.zw.CreateHeader(&fh)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = hw.spool.Seek(0, io.SeekStart)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = io.Copy(w, hw.spool)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
 // nopWriteCloser
 
 type nopWriteCloser struct {
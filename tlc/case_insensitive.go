@@ -1,28 +1,287 @@
 package tlc
 
 import (
+	"fmt"
+	"path"
+	"sort"
 	"strings"
 
-	"github.com/pkg/errors"
+	"github.com/itchio/lake"
 )
 
+// A CaseConflict is a group of paths that only differ by their casing,
+// and thus can't coexist on case-insensitive filesystems.
+type CaseConflict struct {
+	// Paths that conflict, in the order they appear in the container
+	Paths []string
+	// Entries whose path is one of Paths. Parent directories that aren't
+	// listed in the container (like `FOO` for a file `FOO/bar`) conflict
+	// too, but have no entry.
+	Entries []Entry
+}
+
+func (cc CaseConflict) ToString() string {
+	var quoted []string
+	for _, p := range cc.Paths {
+		quoted = append(quoted, fmt.Sprintf("(%s)", p))
+	}
+	return fmt.Sprintf("Case conflict between %s", strings.Join(quoted, " and "))
+}
+
 // AssertCaseInsensitiveSafe returns an error if there
 // exists multiple entries that differ only by their casing,
-// like `foo/bar` and `foo/BAR`
+// like `foo/bar` and `foo/BAR`. It uses full Unicode case
+// folding, so `STRASSE` and `straße` conflict too.
 func (c *Container) AssertCaseInsensitiveSafe() error {
-	paths := make(map[string]string)
+	report := c.Report((*Container).CheckCaseConflicts)
+	return issuesError("Container is not case-insensitive safe, found the following problems:", report.Issues)
+}
+
+// CheckCaseConflicts reports all groups of paths that only differ
+// by their casing (see FindCaseConflicts).
+func (c *Container) CheckCaseConflicts(report *ValidationReport) {
+	for _, cc := range c.FindCaseConflicts() {
+		report.Add(SeverityError, IssueCaseConflict, cc.ToString(), cc.Entries...)
+	}
+}
+
+// FindCaseConflicts returns all groups of paths that only differ by their
+// casing. This includes the parent directories of all entries, whether
+// they're listed in the container or not, so `foo/bar` and `FOO/baz`
+// yield a conflict between `foo` and `FOO`.
+func (c *Container) FindCaseConflicts() []CaseConflict {
+	groups := make(map[string]*CaseConflict)
+	var keys []string
+	seen := make(map[string]bool)
+
+	addPath := func(p string) {
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+
+		key := foldCase(p)
+		group, ok := groups[key]
+		if !ok {
+			group = &CaseConflict{}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.Paths = append(group.Paths, p)
+	}
+
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		for _, parent := range parentPaths(e.GetPath()) {
+			addPath(parent)
+		}
+		addPath(e.GetPath())
+		return ForEachContinue
+	})
+
+	var conflicts []CaseConflict
+	conflictPaths := make(map[string]*CaseConflict)
+	for _, key := range keys {
+		group := groups[key]
+		if len(group.Paths) > 1 {
+			conflicts = append(conflicts, *group)
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		return conflicts[i].Paths[0] < conflicts[j].Paths[0]
+	})
+	for i := range conflicts {
+		for _, p := range conflicts[i].Paths {
+			conflictPaths[p] = &conflicts[i]
+		}
+	}
+
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		if cc, ok := conflictPaths[e.GetPath()]; ok {
+			cc.Entries = append(cc.Entries, e)
+		}
+		return ForEachContinue
+	})
+
+	return conflicts
+}
+
+// parentPaths returns all ancestors of a container path, from
+// the shortest to the longest: `a/b/c` yields `a` and `a/b`.
+func parentPaths(p string) []string {
+	var res []string
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' {
+			res = append(res, p[:i])
+		}
+	}
+	return res
+}
+
+// PlanCaseFixes returns a list of renames that, applied in order (see
+// ApplyCaseFixes), make the container safe to install on case-insensitive
+// filesystems.
+//
+// Directories that only differ by case are merged, keeping the casing that
+// appears first. Files and symlinks that conflict with anything else are
+// given a new name, like `README (2).txt`.
+func (c *Container) PlanCaseFixes() []lake.CaseFix {
+	type item struct {
+		path  string
+		isDir bool
+		depth int
+		// finalPath is where this item ends up once all fixes are applied
+		finalPath string
+	}
 
-	var err error
+	var items []*item
+	itemsByPath := make(map[string]*item)
+	addItem := func(p string, isDir bool) {
+		if existing, ok := itemsByPath[p]; ok {
+			existing.isDir = existing.isDir || isDir
+			return
+		}
+		it := &item{path: p, isDir: isDir, depth: strings.Count(p, "/")}
+		items = append(items, it)
+		itemsByPath[p] = it
+	}
 
 	c.ForEachEntry(func(e Entry) ForEachOutcome {
-		lowerPath := strings.ToLower(e.GetPath())
-		if otherPath, ok := paths[lowerPath]; ok {
-			err = errors.Errorf("Case conflict betwen (%s) and (%s)", otherPath, e.GetPath())
-			return ForEachBreak
+		for _, parent := range parentPaths(e.GetPath()) {
+			addItem(parent, true)
 		}
-		paths[lowerPath] = e.GetPath()
+		_, isDir := e.(*Dir)
+		addItem(e.GetPath(), isDir)
 		return ForEachContinue
 	})
 
-	return err
+	// stable, so that within a depth, container order decides
+	// which casing wins
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].depth < items[j].depth
+	})
+
+	var fixes []lake.CaseFix
+	usedKeys := make(map[string]bool)
+
+	for start := 0; start < len(items); {
+		end := start
+		for end < len(items) && items[end].depth == items[start].depth {
+			end++
+		}
+		level := items[start:end]
+
+		// group by where they'd end up, ignoring case
+		groups := make(map[string][]*item)
+		var keys []string
+		for _, it := range level {
+			finalParent := "."
+			if it.depth > 0 {
+				finalParent = itemsByPath[path.Dir(it.path)].finalPath
+			}
+			it.finalPath = path.Join(finalParent, path.Base(it.path))
+
+			key := foldCase(it.finalPath)
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], it)
+		}
+
+		for _, key := range keys {
+			usedKeys[key] = true
+		}
+
+		for _, key := range keys {
+			group := groups[key]
+
+			// the first directory wins, if any, otherwise the first item
+			winner := group[0]
+			for _, it := range group {
+				if it.isDir {
+					winner = it
+					break
+				}
+			}
+
+			for _, it := range group {
+				if it == winner {
+					continue
+				}
+
+				if it.isDir && winner.isDir {
+					it.finalPath = winner.finalPath
+				} else {
+					it.finalPath = uniqueCasePath(winner.finalPath, usedKeys)
+				}
+
+				newBase := path.Base(it.finalPath)
+				if newBase != path.Base(it.path) {
+					fixes = append(fixes, lake.CaseFix{
+						Old: it.path,
+						New: path.Join(path.Dir(it.path), newBase),
+					})
+				}
+			}
+		}
+
+		start = end
+	}
+
+	// each fix only renames the last component of a path, and is expressed
+	// in terms of the original parent, so applying the deepest ones first
+	// keeps all of them valid.
+	sort.SliceStable(fixes, func(i, j int) bool {
+		return strings.Count(fixes[i].Old, "/") > strings.Count(fixes[j].Old, "/")
+	})
+
+	return fixes
+}
+
+// uniqueCasePath returns a variant of p, like `foo (2).txt` for `foo.txt`,
+// that doesn't conflict with any of usedKeys, and marks it as used.
+func uniqueCasePath(p string, usedKeys map[string]bool) string {
+	dir, base := path.Split(p)
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if stem == "" {
+		// dotfiles, like `.bashrc`
+		stem, ext = base, ""
+	}
+
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s%s (%d)%s", dir, stem, i, ext)
+		key := foldCase(candidate)
+		if !usedKeys[key] {
+			usedKeys[key] = true
+			return candidate
+		}
+	}
+}
+
+// ApplyCaseFixes renames entries of the container according to the given
+// fixes, in order. Directories that end up with the same path are merged,
+// and hardlinks follow their targets.
+func (c *Container) ApplyCaseFixes(fixes []lake.CaseFix) {
+	for _, fix := range fixes {
+		c.ForEachEntry(func(e Entry) ForEachOutcome {
+			if newPath, changed := fix.Apply(e.GetPath()); changed {
+				e.SetPath(newPath)
+			}
+			if h, ok := e.(*Hardlink); ok {
+				h.Target, _ = fix.Apply(h.Target)
+			}
+			return ForEachContinue
+		})
+	}
+
+	seenDirs := make(map[string]bool)
+	var dirs []*Dir
+	for _, d := range c.Dirs {
+		if seenDirs[d.Path] {
+			continue
+		}
+		seenDirs[d.Path] = true
+		dirs = append(dirs, d)
+	}
+	c.Dirs = dirs
 }
@@ -1,8 +1,10 @@
 package tlc_test
 
 import (
+	"os"
 	"testing"
 
+	"github.com/itchio/lake"
 	"github.com/itchio/lake/tlc"
 	"github.com/stretchr/testify/assert"
 )
@@ -46,3 +48,122 @@ func Test_AssertCaseInsensitiveSafe(t *testing.T) {
 	}
 	assert.NoError(c.AssertCaseInsensitiveSafe())
 }
+
+func Test_FindCaseConflicts(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &tlc.Container{
+		Dirs: []*tlc.Dir{
+			&tlc.Dir{Path: "foo"},
+			&tlc.Dir{Path: "Data"},
+		},
+		Files: []*tlc.File{
+			&tlc.File{Path: "foo/a"},
+			&tlc.File{Path: "FOO/b"},
+			&tlc.File{Path: "FOO/a"},
+			&tlc.File{Path: "README"},
+			&tlc.File{Path: "data"},
+			&tlc.File{Path: "readme"},
+		},
+	}
+
+	conflicts := c.FindCaseConflicts()
+	var groups [][]string
+	for _, cc := range conflicts {
+		groups = append(groups, cc.Paths)
+	}
+	assert.EqualValues([][]string{
+		{"Data", "data"},
+		{"README", "readme"},
+		{"foo", "FOO"},
+		{"foo/a", "FOO/a"},
+	}, groups)
+
+	// FOO has no entry, it's only implied by FOO/b and FOO/a
+	assert.EqualValues(1, len(conflicts[2].Entries))
+	assert.EqualValues(2, len(conflicts[3].Entries))
+
+	err := c.AssertCaseInsensitiveSafe()
+	assert.Error(err)
+	t.Logf("As expected:\n%s", err)
+}
+
+func Test_PlanCaseFixes(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &tlc.Container{
+		Dirs: []*tlc.Dir{
+			&tlc.Dir{Path: "foo"},
+			&tlc.Dir{Path: "FOO"},
+			&tlc.Dir{Path: "Data"},
+		},
+		Files: []*tlc.File{
+			&tlc.File{Path: "foo/a"},
+			&tlc.File{Path: "FOO/b"},
+			&tlc.File{Path: "FOO/A"},
+			&tlc.File{Path: "readme.txt"},
+			&tlc.File{Path: "data"},
+			&tlc.File{Path: "README.txt"},
+			&tlc.File{Path: "README (2).txt"},
+		},
+	}
+
+	fixes := c.PlanCaseFixes()
+	assert.EqualValues([]lake.CaseFix{
+		{Old: "FOO/A", New: "FOO/a (2)"},
+		{Old: "FOO", New: "foo"},
+		{Old: "data", New: "Data (2)"},
+		{Old: "README.txt", New: "readme (3).txt"},
+	}, fixes)
+
+	c.ApplyCaseFixes(fixes)
+	assert.NoError(c.AssertCaseInsensitiveSafe())
+	assert.NoError(c.Validate())
+
+	var paths []string
+	c.ForEachEntry(func(e tlc.Entry) tlc.ForEachOutcome {
+		paths = append(paths, e.GetPath())
+		return tlc.ForEachContinue
+	})
+	assert.EqualValues([]string{
+		"foo",
+		"Data",
+		"foo/a",
+		"foo/b",
+		"foo/a (2)",
+		"readme.txt",
+		"Data (2)",
+		"readme (3).txt",
+		"README (2).txt",
+	}, paths)
+
+	// hardlinks follow their targets into merged directories
+	c = &tlc.Container{
+		Dirs: []*tlc.Dir{
+			&tlc.Dir{Path: "data", Mode: 0o755 | uint32(os.ModeDir)},
+			&tlc.Dir{Path: "DATA", Mode: 0o755 | uint32(os.ModeDir)},
+		},
+		Files: []*tlc.File{
+			&tlc.File{Path: "data/a.pak", Mode: 0o644},
+			&tlc.File{Path: "DATA/b.pak", Mode: 0o644},
+		},
+		Hardlinks: []*tlc.Hardlink{
+			&tlc.Hardlink{Path: "DATA/copy.pak", Mode: 0o644, Target: "DATA/b.pak"},
+			&tlc.Hardlink{Path: "link.pak", Mode: 0o644, Target: "DATA/b.pak"},
+		},
+	}
+	fixes = c.PlanCaseFixes()
+	assert.EqualValues([]lake.CaseFix{{Old: "DATA", New: "data"}}, fixes)
+	c.ApplyCaseFixes(fixes)
+	assert.NoError(c.Validate())
+	assert.EqualValues("data/b.pak", c.Hardlinks[0].Target)
+	assert.EqualValues("data/b.pak", c.Hardlinks[1].Target)
+	assert.Empty(c.Report((*tlc.Container).CheckConsistency).Issues)
+
+	safe := &tlc.Container{
+		Files: []*tlc.File{
+			&tlc.File{Path: "foo/bar"},
+		},
+	}
+	assert.Empty(safe.PlanCaseFixes())
+}
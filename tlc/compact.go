@@ -0,0 +1,265 @@
+package tlc
+
+import (
+	"io"
+	"strings"
+)
+
+// An EntryIterator returns entries one by one, and io.EOF once
+// there are none left.
+type EntryIterator interface {
+	Next() (Entry, error)
+}
+
+var _ EntryIterator = (*JSONDecoder)(nil)
+
+// A CompactContainer holds the same information as a Container, using a
+// lot less memory for containers with millions of entries: paths are
+// stored in a trie, so that each directory name is only stored once, and
+// entries don't hold Go pointers unless they have a digest, metadata or
+// an original path.
+//
+// Entries are kept in the order they were added. Use ForEachEntry or
+// Iterator to go through them, and ToContainer to get a regular container.
+type CompactContainer struct {
+	// Size is the total size of all files
+	Size int64
+
+	// the trie of path components, node 0 is the root
+	names   []string
+	parents []int32
+	lookup  map[trieKey]int32
+
+	entries []compactEntry
+}
+
+type trieKey struct {
+	parent int32
+	name   string
+}
+
+type compactEntry struct {
+	node   int32
+	kind   compactKind
+	mode   uint32
+	size   int64
+	offset int64
+	// destination of symlinks, target of hardlinks
+	dest string
+	// optional fields, rarely set
+	extra *compactExtra
+}
+
+type compactKind uint8
+
+const (
+	compactDir compactKind = iota
+	compactFile
+	compactSymlink
+	compactHardlink
+)
+
+type compactExtra struct {
+	originalPath string
+	digest       *Digest
+	metadata     *Metadata
+}
+
+// NewCompactContainer returns an empty compact container
+func NewCompactContainer() *CompactContainer {
+	return &CompactContainer{
+		names:   []string{""},
+		parents: []int32{-1},
+		lookup:  make(map[trieKey]int32),
+	}
+}
+
+// Compact returns a compact version of the container
+func (c *Container) Compact() *CompactContainer {
+	cc := NewCompactContainer()
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		cc.Add(e)
+		return ForEachContinue
+	})
+	cc.Size = c.Size
+	return cc
+}
+
+// Len returns the number of entries in the container
+func (cc *CompactContainer) Len() int {
+	return len(cc.entries)
+}
+
+// Add appends an entry to the container. The entry itself isn't retained,
+// but its digest and metadata (if any) are. The container's size is not
+// updated, since offsets are taken as-is from files.
+func (cc *CompactContainer) Add(e Entry) {
+	ce := compactEntry{
+		node: cc.intern(e.GetPath()),
+		mode: e.GetMode(),
+	}
+
+	var extra compactExtra
+	switch e := e.(type) {
+	case *Dir:
+		ce.kind = compactDir
+	case *File:
+		ce.kind = compactFile
+		ce.size = e.Size
+		ce.offset = e.Offset
+		extra.originalPath = e.OriginalPath
+		extra.digest = e.Digest
+	case *Symlink:
+		ce.kind = compactSymlink
+		ce.dest = e.Dest
+	case *Hardlink:
+		ce.kind = compactHardlink
+		ce.dest = e.Target
+	}
+	extra.metadata = e.GetMetadata()
+	if extra != (compactExtra{}) {
+		ce.extra = &extra
+	}
+
+	cc.entries = append(cc.entries, ce)
+}
+
+// AddAll adds all entries returned by an iterator
+func (cc *CompactContainer) AddAll(it EntryIterator) error {
+	for {
+		e, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cc.Add(e)
+	}
+}
+
+// intern returns the trie node for a path, creating it if needed
+func (cc *CompactContainer) intern(p string) int32 {
+	node := int32(0)
+	for p != "" {
+		name := p
+		rest := ""
+		if i := strings.IndexByte(p, '/'); i != -1 {
+			name, rest = p[:i], p[i+1:]
+		}
+
+		key := trieKey{parent: node, name: name}
+		child, ok := cc.lookup[key]
+		if !ok {
+			// copy the name, so we don't keep the whole path alive
+			key.name = string([]byte(name))
+			child = int32(len(cc.names))
+			cc.names = append(cc.names, key.name)
+			cc.parents = append(cc.parents, node)
+			cc.lookup[key] = child
+		}
+		node, p = child, rest
+	}
+	return node
+}
+
+// path rebuilds the full path of a trie node
+func (cc *CompactContainer) path(node int32) string {
+	length := -1
+	for n := node; n > 0; n = cc.parents[n] {
+		length += len(cc.names[n]) + 1
+	}
+	if length <= 0 {
+		return ""
+	}
+
+	buf := make([]byte, length)
+	i := length
+	for n := node; n > 0; n = cc.parents[n] {
+		name := cc.names[n]
+		i -= len(name)
+		copy(buf[i:], name)
+		if i > 0 {
+			i--
+			buf[i] = '/'
+		}
+	}
+	return string(buf)
+}
+
+// entry materializes the i-th entry
+func (cc *CompactContainer) entry(i int) Entry {
+	ce := &cc.entries[i]
+	p := cc.path(ce.node)
+
+	var e Entry
+	switch ce.kind {
+	case compactDir:
+		e = &Dir{Path: p, Mode: ce.mode}
+	case compactFile:
+		f := &File{Path: p, Mode: ce.mode, Size: ce.size, Offset: ce.offset}
+		if ce.extra != nil {
+			f.OriginalPath = ce.extra.originalPath
+			f.Digest = ce.extra.digest
+		}
+		e = f
+	case compactSymlink:
+		e = &Symlink{Path: p, Mode: ce.mode, Dest: ce.dest}
+	case compactHardlink:
+		e = &Hardlink{Path: p, Mode: ce.mode, Target: ce.dest}
+	}
+	if ce.extra != nil && ce.extra.metadata != nil {
+		e.SetMetadata(ce.extra.metadata)
+	}
+	return e
+}
+
+// ForEachEntry calls f with all entries of the container, in the order they
+// were added. Entries are created on the fly: modifying them doesn't modify
+// the container.
+func (cc *CompactContainer) ForEachEntry(f func(e Entry) ForEachOutcome) {
+	for i := range cc.entries {
+		if f(cc.entry(i)) == ForEachBreak {
+			return
+		}
+	}
+}
+
+// Iterator returns an iterator over all entries of the container,
+// see ForEachEntry.
+func (cc *CompactContainer) Iterator() EntryIterator {
+	return &compactIterator{cc: cc}
+}
+
+type compactIterator struct {
+	cc    *CompactContainer
+	index int
+}
+
+func (it *compactIterator) Next() (Entry, error) {
+	if it.index >= len(it.cc.entries) {
+		return nil, io.EOF
+	}
+	e := it.cc.entry(it.index)
+	it.index++
+	return e, nil
+}
+
+// ToContainer returns a regular container with the same entries
+func (cc *CompactContainer) ToContainer() *Container {
+	c := &Container{Size: cc.Size}
+	cc.ForEachEntry(func(e Entry) ForEachOutcome {
+		switch e := e.(type) {
+		case *Dir:
+			c.Dirs = append(c.Dirs, e)
+		case *File:
+			c.Files = append(c.Files, e)
+		case *Symlink:
+			c.Symlinks = append(c.Symlinks, e)
+		case *Hardlink:
+			c.Hardlinks = append(c.Hardlinks, e)
+		}
+		return ForEachContinue
+	})
+	return c
+}
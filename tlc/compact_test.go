@@ -0,0 +1,93 @@
+package tlc_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/itchio/lake/tlc"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Compact(t *testing.T) {
+	assert := assert.New(t)
+
+	c := exportTestContainer()
+	cc := c.Compact()
+	assert.EqualValues(5, cc.Len())
+	assert.EqualValues(c.Size, cc.Size)
+	assert.True(proto.Equal(c, cc.ToContainer()))
+
+	var paths []string
+	it := cc.Iterator()
+	for {
+		e, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(err)
+		paths = append(paths, e.GetPath())
+	}
+	assert.EqualValues([]string{"data", "data/level1.pak", "game.exe", "data/latest.pak", "data/copy.pak"}, paths)
+
+	// entries are created on the fly
+	cc.ForEachEntry(func(e tlc.Entry) tlc.ForEachOutcome {
+		e.(*tlc.Dir).Path = "elsewhere"
+		return tlc.ForEachBreak
+	})
+	assert.True(proto.Equal(c, cc.ToContainer()))
+
+	raw, err := proto.Marshal(c)
+	assert.NoError(err)
+	cc2, err := tlc.ReadCompact(bytes.NewReader(raw))
+	assert.NoError(err)
+	assert.EqualValues(c.Size, cc2.Size)
+	assert.True(proto.Equal(c, cc2.ToContainer()))
+
+	_, err = tlc.ReadCompact(bytes.NewReader(raw[:len(raw)-10]))
+	assert.Error(err)
+}
+
+func Test_ContainerFileCompact(t *testing.T) {
+	assert := assert.New(t)
+
+	c := exportTestContainer()
+
+	for _, compression := range []tlc.Compression{tlc.CompressionNone, tlc.CompressionZstd, tlc.CompressionBrotli} {
+		buf := new(bytes.Buffer)
+		assert.NoError(tlc.WriteContainer(buf, c, tlc.WriteContainerOpts{Compression: compression}), compression.String())
+
+		cc, err := tlc.ReadContainerCompact(bytes.NewReader(buf.Bytes()))
+		assert.NoError(err, compression.String())
+		assert.True(proto.Equal(c, cc.ToContainer()), compression.String())
+
+		b := buf.Bytes()
+		b[len(b)-1] ^= 0xff
+		_, err = tlc.ReadContainerCompact(bytes.NewReader(b))
+		assert.EqualValues(tlc.ErrContainerChecksumMismatch, errors.Cause(err), compression.String())
+	}
+}
+
+func Test_WalkDirCompact(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "walk-compact")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "a", "b"), 0o755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "a", "b", "c.txt"), []byte("hello"), 0o644))
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "a", "d.txt"), []byte("hi"), 0o644))
+
+	c, err := tlc.WalkDir(dir, tlc.WalkOpts{})
+	assert.NoError(err)
+	cc, err := tlc.WalkDirCompact(dir, tlc.WalkOpts{})
+	assert.NoError(err)
+	assert.EqualValues(7, cc.Size)
+	assert.True(proto.Equal(c, cc.ToContainer()))
+}
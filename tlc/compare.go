@@ -42,6 +42,27 @@ func (c1 *Container) EnsureEqual(c2 *Container) error {
 		}
 	}
 
+	hardlinks1, hardlinksmap1 := sortedHardlinks(c1)
+	hardlinks2, hardlinksmap2 := sortedHardlinks(c2)
+
+	if len(hardlinks1) != len(hardlinks2) {
+		return fmt.Errorf("expected %d hardlinks, got %d hardlinks", len(hardlinks1), len(hardlinks2))
+	}
+
+	for i := range hardlinks1 {
+		path1 := hardlinks1[i]
+		path2 := hardlinks2[i]
+		if path1 != path2 {
+			return fmt.Errorf("expected hardlink %d to be %s, was %s", i, path1, path2)
+		}
+
+		target1 := hardlinksmap1[path1]
+		target2 := hardlinksmap2[path2]
+		if target1 != target2 {
+			return fmt.Errorf("expected hardlink %s to point to %s, pointed to %s", path1, target1, target2)
+		}
+	}
+
 	files1, filesmap1 := sortedFiles(c1)
 	files2, filesmap2 := sortedFiles(c2)
 
@@ -61,6 +82,10 @@ func (c1 *Container) EnsureEqual(c2 *Container) error {
 		if f1.Size != f2.Size {
 			return fmt.Errorf("expected file %s to have size %d, had size %d", path1, f1.Size, f2.Size)
 		}
+
+		if comparableDigests(f1, f2) && !f1.Digest.Equal(f2.Digest) {
+			return fmt.Errorf("expected file %s to have digest %s, had digest %s", path1, f1.Digest.ToString(), f2.Digest.ToString())
+		}
 	}
 
 	return nil
@@ -86,6 +111,17 @@ func sortedLinks(c *Container) ([]string, map[string]string) {
 	return links, linksmap
 }
 
+func sortedHardlinks(c *Container) ([]string, map[string]string) {
+	hardlinks := []string{}
+	hardlinksmap := make(map[string]string)
+	for _, h := range c.Hardlinks {
+		hardlinks = append(hardlinks, h.Path)
+		hardlinksmap[h.Path] = h.Target
+	}
+	sort.Strings(hardlinks)
+	return hardlinks, hardlinksmap
+}
+
 func sortedFiles(c *Container) ([]string, map[string]*File) {
 	files := []string{}
 	filesmap := make(map[string]*File)
@@ -0,0 +1,170 @@
+package tlc
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// CheckConsistency reports structural problems: file offsets that aren't
+// contiguous or don't add up to the container's size, entries whose parent
+// directory isn't listed in Dirs, modes with the wrong type bits, and
+// hardlinks whose target isn't a file of the container.
+func (c *Container) CheckConsistency(report *ValidationReport) {
+	offset := int64(0)
+	for _, f := range c.Files {
+		if f.Size < 0 {
+			report.Add(SeverityError, IssueOffsetMismatch, fmt.Sprintf("File has negative size %d", f.Size), f)
+		}
+		if f.Offset != offset {
+			report.Add(SeverityError, IssueOffsetMismatch, fmt.Sprintf("File should be at offset %d, but is at offset %d", offset, f.Offset), f)
+		}
+		offset += f.Size
+	}
+
+	if offset != c.Size {
+		report.Add(SeverityError, IssueOffsetMismatch, fmt.Sprintf("Container size is %d, but its files add up to %d", c.Size, offset))
+	}
+
+	dirs := make(map[string]bool)
+	for _, d := range c.Dirs {
+		dirs[d.Path] = true
+	}
+
+	files := make(map[string]bool)
+	for _, f := range c.Files {
+		files[f.Path] = true
+	}
+	for _, h := range c.Hardlinks {
+		if !files[h.Target] {
+			report.Add(SeverityError, IssueBadHardlink, fmt.Sprintf("Hardlink target (%s) is not a file of the container", h.Target), h)
+		}
+	}
+
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		if ValidatePath(e.GetPath()) != nil {
+			// that's for CheckPaths to report
+			return ForEachContinue
+		}
+
+		parent := path.Dir(e.GetPath())
+		if parent != "." && !dirs[parent] {
+			report.Add(SeverityError, IssueMissingParent, fmt.Sprintf("Parent directory (%s) is not listed", parent), e)
+		}
+
+		mode := os.FileMode(e.GetMode())
+		var expected os.FileMode
+		switch e.(type) {
+		case *Dir:
+			expected = os.ModeDir
+		case *Symlink:
+			expected = os.ModeSymlink
+		}
+		if mode&os.ModeType != expected {
+			report.Add(SeverityError, IssueBadMode, fmt.Sprintf("Mode %s has the wrong type bits", mode), e)
+		}
+		return ForEachContinue
+	})
+}
+
+// Normalize sorts entries by path (in the order WalkDir would find them),
+// removes duplicate entries of the same type, adds missing parent directories,
+// and recomputes file offsets and the container's size.
+//
+// Since files may be reordered, file indices change: pools built for the
+// container before it was normalized must not be used afterwards.
+func (c *Container) Normalize() {
+	seenDirs := make(map[string]bool)
+	var dirs []*Dir
+	addDir := func(d *Dir) {
+		if seenDirs[d.Path] {
+			return
+		}
+		seenDirs[d.Path] = true
+		dirs = append(dirs, d)
+	}
+
+	for _, d := range c.Dirs {
+		addDir(d)
+	}
+
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		for _, parent := range parentPaths(e.GetPath()) {
+			addDir(&Dir{Path: parent, Mode: uint32(0o755 | os.ModeDir)})
+		}
+		return ForEachContinue
+	})
+
+	seenFiles := make(map[string]bool)
+	var files []*File
+	for _, f := range c.Files {
+		if seenFiles[f.Path] {
+			continue
+		}
+		seenFiles[f.Path] = true
+		files = append(files, f)
+	}
+
+	seenSymlinks := make(map[string]bool)
+	var symlinks []*Symlink
+	for _, s := range c.Symlinks {
+		if seenSymlinks[s.Path] {
+			continue
+		}
+		seenSymlinks[s.Path] = true
+		symlinks = append(symlinks, s)
+	}
+
+	seenHardlinks := make(map[string]bool)
+	var hardlinks []*Hardlink
+	for _, h := range c.Hardlinks {
+		if seenHardlinks[h.Path] {
+			continue
+		}
+		seenHardlinks[h.Path] = true
+		hardlinks = append(hardlinks, h)
+	}
+
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return comparePaths(dirs[i].Path, dirs[j].Path) < 0
+	})
+	sort.SliceStable(files, func(i, j int) bool {
+		return comparePaths(files[i].Path, files[j].Path) < 0
+	})
+	sort.SliceStable(symlinks, func(i, j int) bool {
+		return comparePaths(symlinks[i].Path, symlinks[j].Path) < 0
+	})
+	sort.SliceStable(hardlinks, func(i, j int) bool {
+		return comparePaths(hardlinks[i].Path, hardlinks[j].Path) < 0
+	})
+
+	offset := int64(0)
+	for _, f := range files {
+		f.Offset = offset
+		offset += f.Size
+	}
+
+	c.Dirs = dirs
+	c.Files = files
+	c.Symlinks = symlinks
+	c.Hardlinks = hardlinks
+	c.Size = offset
+}
+
+// comparePaths compares container paths component by component, so
+// that `foo/bar` sorts before `foo.txt`, like filepath.Walk does.
+func comparePaths(a string, b string) int {
+	as := strings.Split(a, "/")
+	bs := strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(as) - len(bs)
+}
@@ -0,0 +1,83 @@
+package tlc_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CheckConsistency(t *testing.T) {
+	assert := assert.New(t)
+
+	dirMode := 0o755 | uint32(os.ModeDir)
+	c := &tlc.Container{
+		Dirs: []*tlc.Dir{
+			&tlc.Dir{Path: "b", Mode: 0o755},
+		},
+		Files: []*tlc.File{
+			&tlc.File{Path: "b/two", Mode: 0o644, Size: 2, Offset: 0},
+			&tlc.File{Path: "a/one", Mode: 0o644, Size: 1, Offset: 1},
+			&tlc.File{Path: "b/two", Mode: 0o644, Size: 2, Offset: 3},
+		},
+		Symlinks: []*tlc.Symlink{
+			&tlc.Symlink{Path: "a/link", Mode: 0o644, Dest: "one"},
+		},
+		Size: 4,
+	}
+
+	report := c.Report((*tlc.Container).CheckConsistency)
+	counts := make(map[tlc.IssueKind]int)
+	for _, issue := range report.Issues {
+		counts[issue.Kind]++
+	}
+	report.Print(func(line string) {
+		t.Logf("%s", line)
+	})
+	assert.EqualValues(map[tlc.IssueKind]int{
+		// a/one is at the wrong offset, and sizes don't add up
+		tlc.IssueOffsetMismatch: 2,
+		// a/one and a/link
+		tlc.IssueMissingParent: 2,
+		// b and a/link
+		tlc.IssueBadMode: 2,
+	}, counts)
+
+	c.Dirs[0].Mode = dirMode
+	c.Symlinks[0].Mode |= uint32(os.ModeSymlink)
+	c.Normalize()
+
+	var paths []string
+	c.ForEachEntry(func(e tlc.Entry) tlc.ForEachOutcome {
+		paths = append(paths, e.GetPath())
+		return tlc.ForEachContinue
+	})
+	assert.EqualValues([]string{"a", "b", "a/one", "b/two", "a/link"}, paths)
+	assert.EqualValues(dirMode, c.Dirs[0].Mode, "synthesized dirs should have a proper mode")
+	assert.EqualValues(0, c.Files[0].Offset)
+	assert.EqualValues(1, c.Files[1].Offset)
+	assert.EqualValues(3, c.Size)
+
+	assert.NoError(c.Report().Err())
+}
+
+func Test_NormalizeOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &tlc.Container{
+		Files: []*tlc.File{
+			&tlc.File{Path: "foo.txt", Size: 1},
+			&tlc.File{Path: "foo/bar", Size: 2},
+			&tlc.File{Path: "Foo", Size: 3},
+		},
+	}
+	c.Normalize()
+
+	var paths []string
+	for _, f := range c.Files {
+		paths = append(paths, f.Path)
+	}
+	assert.EqualValues([]string{"Foo", "foo/bar", "foo.txt"}, paths, "should sort like filepath.Walk")
+	assert.EqualValues(6, c.Size)
+}
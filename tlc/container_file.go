@@ -0,0 +1,350 @@
+package tlc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/andybalholm/brotli"
+	"github.com/golang/protobuf/proto"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// A container file is laid out like this, with all integers in little-endian:
+//
+//	magic          [4]byte   "LTLC"
+//	version        uint16    ContainerFileVersion
+//	compression    uint8     see Compression
+//	reserved       uint8     0
+//	payload size   uint64    size of the (possibly compressed) payload
+//	payload        []byte    protobuf-encoded Container
+//	checksum       [32]byte  SHA-256 of the uncompressed payload
+var containerFileMagic = []byte("LTLC")
+
+// ContainerFileVersion is the newest container file format version
+// ReadContainer supports, and the one WriteContainer writes.
+const ContainerFileVersion = 1
+
+var (
+	ErrNotAContainerFile               = errors.New("Not a container file: magic header not found")
+	ErrUnsupportedContainerVersion     = errors.New("Unsupported container file version")
+	ErrUnsupportedContainerCompression = errors.New("Unsupported container file compression")
+	ErrContainerChecksumMismatch       = errors.New("Container file checksum mismatch, the file is corrupted")
+	ErrContainerTooLarge               = errors.New("Container file payload is too large")
+)
+
+// MaxContainerSize is the largest (uncompressed) payload ReadContainer and
+// ReadContainerCompact accept, so that a small, hostile container file
+// can't make them decompress gigabytes of data.
+var MaxContainerSize int64 = 1 << 30
+
+// Compression is the algorithm used to compress the
+// payload of a container file
+type Compression uint8
+
+const (
+	CompressionNone   Compression = 0
+	CompressionZstd   Compression = 1
+	CompressionBrotli Compression = 2
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionZstd:
+		return "zstd"
+	case CompressionBrotli:
+		return "brotli"
+	}
+	return fmt.Sprintf("Compression(%d)", uint8(c))
+}
+
+type WriteContainerOpts struct {
+	Compression Compression
+
+	// Quality is passed to the compressor: from 1 (fastest) to 4 (best)
+	// for zstd, from 1 to 11 for brotli. Zero picks a sensible default.
+	Quality int
+}
+
+type containerFileHeader struct {
+	Magic       [4]byte
+	Version     uint16
+	Compression Compression
+	Reserved    uint8
+	PayloadSize uint64
+}
+
+// WriteContainer writes a self-describing container file,
+// which can be read back with ReadContainer.
+func WriteContainer(w io.Writer, c *Container, opts WriteContainerOpts) error {
+	raw, err := proto.Marshal(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	checksum := sha256.Sum256(raw)
+
+	payload, err := compressPayload(raw, opts)
+	if err != nil {
+		return err
+	}
+
+	header := containerFileHeader{
+		Version:     ContainerFileVersion,
+		Compression: opts.Compression,
+		PayloadSize: uint64(len(payload)),
+	}
+	copy(header.Magic[:], containerFileMagic)
+
+	err = binary.Write(w, binary.LittleEndian, &header)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = w.Write(payload)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = w.Write(checksum[:])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// ReadContainer reads a container file written by WriteContainer, and
+// verifies its checksum.
+func ReadContainer(r io.Reader) (*Container, error) {
+	header, err := readContainerFileHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// don't trust the size from the header enough to allocate it all at once
+	payload, err := ioutil.ReadAll(io.LimitReader(r, int64(header.PayloadSize)))
+	if err != nil {
+		return nil, errors.WithMessage(err, "while reading container file payload")
+	}
+	if uint64(len(payload)) != header.PayloadSize {
+		return nil, errors.Errorf("Container file truncated: expected %d bytes of payload, got %d", header.PayloadSize, len(payload))
+	}
+
+	var checksum [sha256.Size]byte
+	_, err = io.ReadFull(r, checksum[:])
+	if err != nil {
+		return nil, errors.WithMessage(err, "while reading container file checksum")
+	}
+
+	raw, err := decompressPayload(payload, header.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if sha256.Sum256(raw) != checksum {
+		return nil, errors.WithStack(ErrContainerChecksumMismatch)
+	}
+
+	c := &Container{}
+	err = proto.Unmarshal(raw, c)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return c, nil
+}
+
+// ReadContainerCompact reads a container file written by WriteContainer
+// into a CompactContainer. Unlike ReadContainer, it decompresses and decodes
+// the payload as it goes, so neither the payload nor a full Container are
+// ever held in memory.
+func ReadContainerCompact(r io.Reader) (*CompactContainer, error) {
+	header, err := readContainerFileHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &countingReader{r: io.LimitReader(r, int64(header.PayloadSize))}
+	raw, closer, err := decompressStream(payload, header.Compression)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	h := sha256.New()
+	cc, err := ReadCompact(io.TeeReader(raw, h))
+	if err != nil {
+		return nil, err
+	}
+
+	// make sure the checksum is read from the right place
+	_, err = io.Copy(ioutil.Discard, payload)
+	if err != nil {
+		return nil, errors.WithMessage(err, "while reading container file payload")
+	}
+	if uint64(payload.count) != header.PayloadSize {
+		return nil, errors.Errorf("Container file truncated: expected %d bytes of payload, got %d", header.PayloadSize, payload.count)
+	}
+
+	var checksum [sha256.Size]byte
+	_, err = io.ReadFull(r, checksum[:])
+	if err != nil {
+		return nil, errors.WithMessage(err, "while reading container file checksum")
+	}
+	if !bytes.Equal(h.Sum(nil), checksum[:]) {
+		return nil, errors.WithStack(ErrContainerChecksumMismatch)
+	}
+	return cc, nil
+}
+
+func readContainerFileHeader(r io.Reader) (*containerFileHeader, error) {
+	var header containerFileHeader
+	err := binary.Read(r, binary.LittleEndian, &header)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errors.WithStack(ErrNotAContainerFile)
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	if !bytes.Equal(header.Magic[:], containerFileMagic) {
+		return nil, errors.WithStack(ErrNotAContainerFile)
+	}
+
+	if header.Version == 0 || header.Version > ContainerFileVersion {
+		return nil, errors.Wrapf(ErrUnsupportedContainerVersion, "file is version %d, this version of lake supports up to version %d", header.Version, ContainerFileVersion)
+	}
+	return &header, nil
+}
+
+type countingReader struct {
+	r     io.Reader
+	count int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
+
+func compressPayload(raw []byte, opts WriteContainerOpts) ([]byte, error) {
+	switch opts.Compression {
+	case CompressionNone:
+		return raw, nil
+	case CompressionZstd:
+		level := zstd.SpeedDefault
+		if opts.Quality != 0 {
+			level = zstd.EncoderLevel(opts.Quality)
+		}
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer enc.Close()
+		return enc.EncodeAll(raw, nil), nil
+	case CompressionBrotli:
+		quality := brotli.DefaultCompression
+		if opts.Quality != 0 {
+			quality = opts.Quality
+		}
+		buf := new(bytes.Buffer)
+		bw := brotli.NewWriterLevel(buf, quality)
+		_, err := bw.Write(raw)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		err = bw.Close()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, errors.Wrapf(ErrUnsupportedContainerCompression, "%s", opts.Compression)
+}
+
+func decompressPayload(payload []byte, compression Compression) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		if int64(len(payload)) > MaxContainerSize {
+			return nil, errContainerTooLarge()
+		}
+		return payload, nil
+	case CompressionZstd:
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(MaxContainerSize)))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer dec.Close()
+		raw, err := dec.DecodeAll(payload, nil)
+		if err != nil {
+			return nil, errors.WithMessage(decompressError(err), "while decompressing container file")
+		}
+		return raw, nil
+	case CompressionBrotli:
+		raw, err := ioutil.ReadAll(&maxSizeReader{r: brotli.NewReader(bytes.NewReader(payload)), remaining: MaxContainerSize})
+		if err != nil {
+			return nil, errors.WithMessage(err, "while decompressing container file")
+		}
+		return raw, nil
+	}
+	return nil, errors.Wrapf(ErrUnsupportedContainerCompression, "%s", compression)
+}
+
+// decompressStream is the streaming version of decompressPayload, the
+// returned func must be called once done reading
+func decompressStream(payload io.Reader, compression Compression) (io.Reader, func(), error) {
+	switch compression {
+	case CompressionNone:
+		return &maxSizeReader{r: payload, remaining: MaxContainerSize}, func() {}, nil
+	case CompressionZstd:
+		dec, err := zstd.NewReader(payload, zstd.WithDecoderMaxMemory(uint64(MaxContainerSize)))
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		return &maxSizeReader{r: dec, remaining: MaxContainerSize}, dec.Close, nil
+	case CompressionBrotli:
+		return &maxSizeReader{r: brotli.NewReader(payload), remaining: MaxContainerSize}, func() {}, nil
+	}
+	return nil, nil, errors.Wrapf(ErrUnsupportedContainerCompression, "%s", compression)
+}
+
+// maxSizeReader fails with ErrContainerTooLarge if more
+// than remaining bytes can be read from r
+type maxSizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (mr *maxSizeReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > mr.remaining+1 {
+		p = p[:mr.remaining+1]
+	}
+	n, err := mr.r.Read(p)
+	if int64(n) > mr.remaining {
+		return 0, errContainerTooLarge()
+	}
+	mr.remaining -= int64(n)
+	if err != nil && err != io.EOF {
+		err = decompressError(err)
+	}
+	return n, err
+}
+
+func errContainerTooLarge() error {
+	return errors.Wrapf(ErrContainerTooLarge, "over %d bytes", MaxContainerSize)
+}
+
+// decompressError turns the errors decompressors return
+// when hitting MaxContainerSize into ErrContainerTooLarge
+func decompressError(err error) error {
+	if err == zstd.ErrDecoderSizeExceeded || err == zstd.ErrWindowSizeExceeded {
+		return errContainerTooLarge()
+	}
+	return err
+}
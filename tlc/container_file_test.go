@@ -0,0 +1,89 @@
+package tlc_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/itchio/lake/tlc"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ContainerFile(t *testing.T) {
+	assert := assert.New(t)
+
+	c := exportTestContainer()
+
+	for _, compression := range []tlc.Compression{tlc.CompressionNone, tlc.CompressionZstd, tlc.CompressionBrotli} {
+		buf := new(bytes.Buffer)
+		assert.NoError(tlc.WriteContainer(buf, c, tlc.WriteContainerOpts{Compression: compression}), compression.String())
+		assert.EqualValues("LTLC", buf.Bytes()[:4])
+
+		c2, err := tlc.ReadContainer(bytes.NewReader(buf.Bytes()))
+		assert.NoError(err, compression.String())
+		assert.True(proto.Equal(c, c2), compression.String())
+	}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(tlc.WriteContainer(buf, c, tlc.WriteContainerOpts{Compression: tlc.CompressionZstd}))
+	good := buf.Bytes()
+
+	tamper := func(f func(b []byte) []byte) error {
+		b := append([]byte{}, good...)
+		_, err := tlc.ReadContainer(bytes.NewReader(f(b)))
+		return err
+	}
+
+	err := tamper(func(b []byte) []byte { b[0] = 'X'; return b })
+	assert.EqualValues(tlc.ErrNotAContainerFile, errors.Cause(err))
+
+	err = tamper(func(b []byte) []byte { return b[:2] })
+	assert.EqualValues(tlc.ErrNotAContainerFile, errors.Cause(err))
+
+	err = tamper(func(b []byte) []byte { b[4] = 2; return b })
+	assert.EqualValues(tlc.ErrUnsupportedContainerVersion, errors.Cause(err))
+	assert.Contains(err.Error(), "version 2")
+
+	err = tamper(func(b []byte) []byte { b[6] = 42; return b })
+	assert.EqualValues(tlc.ErrUnsupportedContainerCompression, errors.Cause(err))
+
+	err = tamper(func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b })
+	assert.EqualValues(tlc.ErrContainerChecksumMismatch, errors.Cause(err))
+
+	err = tamper(func(b []byte) []byte { return b[:len(b)-40] })
+	assert.Error(err)
+
+	err = tlc.WriteContainer(new(bytes.Buffer), c, tlc.WriteContainerOpts{Compression: 42})
+	assert.EqualValues(tlc.ErrUnsupportedContainerCompression, errors.Cause(err))
+}
+
+func Test_ContainerFileMaxSize(t *testing.T) {
+	assert := assert.New(t)
+
+	c := exportTestContainer()
+	raw, err := proto.Marshal(c)
+	assert.NoError(err)
+
+	defer func(max int64) { tlc.MaxContainerSize = max }(tlc.MaxContainerSize)
+	tlc.MaxContainerSize = int64(len(raw)) - 1
+
+	for _, compression := range []tlc.Compression{tlc.CompressionNone, tlc.CompressionZstd, tlc.CompressionBrotli} {
+		buf := new(bytes.Buffer)
+		assert.NoError(tlc.WriteContainer(buf, c, tlc.WriteContainerOpts{Compression: compression}), compression.String())
+
+		_, err := tlc.ReadContainer(bytes.NewReader(buf.Bytes()))
+		assert.EqualValues(tlc.ErrContainerTooLarge, errors.Cause(err), compression.String())
+
+		_, err = tlc.ReadContainerCompact(bytes.NewReader(buf.Bytes()))
+		assert.EqualValues(tlc.ErrContainerTooLarge, errors.Cause(err), compression.String())
+	}
+
+	tlc.MaxContainerSize = int64(len(raw))
+	buf := new(bytes.Buffer)
+	assert.NoError(tlc.WriteContainer(buf, c, tlc.WriteContainerOpts{Compression: tlc.CompressionBrotli}))
+	_, err = tlc.ReadContainer(bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+	_, err = tlc.ReadContainerCompact(bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+}
@@ -0,0 +1,177 @@
+package tlc
+
+import (
+	"os"
+	"sort"
+)
+
+// A DiffEntry describes an entry that was added or removed
+type DiffEntry struct {
+	Path string    `json:"path"`
+	Type EntryType `json:"type"`
+	Mode uint32    `json:"mode"`
+	Size int64     `json:"size,omitempty"`
+	Dest string    `json:"dest,omitempty"`
+}
+
+func newDiffEntry(e Entry) DiffEntry {
+	de := DiffEntry{
+		Path: e.GetPath(),
+		Type: EntryTypeOf(e),
+		Mode: e.GetMode(),
+	}
+	switch e := e.(type) {
+	case *File:
+		de.Size = e.Size
+	case *Symlink:
+		de.Dest = e.Dest
+	case *Hardlink:
+		de.Dest = e.Target
+	}
+	return de
+}
+
+// A Resize describes a file whose size changed
+type Resize struct {
+	Path    string `json:"path"`
+	OldSize int64  `json:"oldSize"`
+	NewSize int64  `json:"newSize"`
+}
+
+// A ModeChange describes an entry whose permissions changed
+type ModeChange struct {
+	Path    string    `json:"path"`
+	Type    EntryType `json:"type"`
+	OldMode uint32    `json:"oldMode"`
+	NewMode uint32    `json:"newMode"`
+}
+
+// A TypeChange describes a path that went from being a file, a dir
+// or a symlink, to being another one of those.
+type TypeChange struct {
+	Path    string    `json:"path"`
+	OldType EntryType `json:"oldType"`
+	NewType EntryType `json:"newType"`
+}
+
+// A ContentChange describes a file whose size stayed the same but whose
+// contents changed, which can only be detected when both containers
+// have hashes (see ComputeHashes)
+type ContentChange struct {
+	Path      string `json:"path"`
+	OldDigest string `json:"oldDigest"`
+	NewDigest string `json:"newDigest"`
+}
+
+// A Retarget describes a symlink whose destination changed,
+// or a hardlink whose target changed
+type Retarget struct {
+	Path    string `json:"path"`
+	OldDest string `json:"oldDest"`
+	NewDest string `json:"newDest"`
+}
+
+// A ContainerDiff lists all differences between two containers.
+// All lists are sorted by path.
+type ContainerDiff struct {
+	Added          []DiffEntry     `json:"added,omitempty"`
+	Removed        []DiffEntry     `json:"removed,omitempty"`
+	Resized        []Resize        `json:"resized,omitempty"`
+	ContentChanged []ContentChange `json:"contentChanged,omitempty"`
+	ModeChanged    []ModeChange    `json:"modeChanged,omitempty"`
+	TypeChanged    []TypeChange    `json:"typeChanged,omitempty"`
+	Retargeted     []Retarget      `json:"retargeted,omitempty"`
+}
+
+// IsEmpty returns true if both containers had the same entries,
+// with the same types, sizes, contents (when hashed), permissions and
+// symlink destinations.
+func (d *ContainerDiff) IsEmpty() bool {
+	return len(d.Added) == 0 &&
+		len(d.Removed) == 0 &&
+		len(d.Resized) == 0 &&
+		len(d.ContentChanged) == 0 &&
+		len(d.ModeChanged) == 0 &&
+		len(d.TypeChanged) == 0 &&
+		len(d.Retargeted) == 0
+}
+
+// Diff returns all changes needed to go from c1 to c2. Only permission
+// bits are compared for modes, since type changes are reported separately.
+// File contents are compared when both sides have digests computed with
+// the same algorithm.
+func (c1 *Container) Diff(c2 *Container) *ContainerDiff {
+	entries1 := entriesByPath(c1)
+	entries2 := entriesByPath(c2)
+
+	var paths []string
+	for p := range entries1 {
+		paths = append(paths, p)
+	}
+	for p := range entries2 {
+		if _, ok := entries1[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return comparePaths(paths[i], paths[j]) < 0
+	})
+
+	d := &ContainerDiff{}
+	for _, p := range paths {
+		e1, ok1 := entries1[p]
+		e2, ok2 := entries2[p]
+
+		switch {
+		case !ok1:
+			d.Added = append(d.Added, newDiffEntry(e2))
+			continue
+		case !ok2:
+			d.Removed = append(d.Removed, newDiffEntry(e1))
+			continue
+		}
+
+		t1, t2 := EntryTypeOf(e1), EntryTypeOf(e2)
+		if t1 != t2 {
+			d.TypeChanged = append(d.TypeChanged, TypeChange{Path: p, OldType: t1, NewType: t2})
+			continue
+		}
+
+		m1 := os.FileMode(e1.GetMode()) &^ os.ModeType
+		m2 := os.FileMode(e2.GetMode()) &^ os.ModeType
+		if m1 != m2 {
+			d.ModeChanged = append(d.ModeChanged, ModeChange{Path: p, Type: t1, OldMode: e1.GetMode(), NewMode: e2.GetMode()})
+		}
+
+		switch e1 := e1.(type) {
+		case *File:
+			f2 := e2.(*File)
+			if e1.Size != f2.Size {
+				d.Resized = append(d.Resized, Resize{Path: p, OldSize: e1.Size, NewSize: f2.Size})
+			} else if comparableDigests(e1, f2) && !e1.Digest.Equal(f2.Digest) {
+				d.ContentChanged = append(d.ContentChanged, ContentChange{Path: p, OldDigest: e1.Digest.ToString(), NewDigest: f2.Digest.ToString()})
+			}
+		case *Symlink:
+			s2 := e2.(*Symlink)
+			if e1.Dest != s2.Dest {
+				d.Retargeted = append(d.Retargeted, Retarget{Path: p, OldDest: e1.Dest, NewDest: s2.Dest})
+			}
+		case *Hardlink:
+			h2 := e2.(*Hardlink)
+			if e1.Target != h2.Target {
+				d.Retargeted = append(d.Retargeted, Retarget{Path: p, OldDest: e1.Target, NewDest: h2.Target})
+			}
+		}
+	}
+
+	return d
+}
+
+func entriesByPath(c *Container) map[string]Entry {
+	res := make(map[string]Entry)
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		res[e.GetPath()] = e
+		return ForEachContinue
+	})
+	return res
+}
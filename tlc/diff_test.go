@@ -0,0 +1,81 @@
+package tlc_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Diff(t *testing.T) {
+	assert := assert.New(t)
+
+	dirMode := 0o755 | uint32(os.ModeDir)
+	linkMode := 0o644 | uint32(os.ModeSymlink)
+
+	c1 := &tlc.Container{
+		Dirs: []*tlc.Dir{
+			&tlc.Dir{Path: "data", Mode: dirMode},
+			&tlc.Dir{Path: "old", Mode: dirMode},
+		},
+		Files: []*tlc.File{
+			&tlc.File{Path: "game.exe", Mode: 0o644, Size: 100},
+			&tlc.File{Path: "data/a.pak", Mode: 0o644, Size: 10},
+			&tlc.File{Path: "save", Mode: 0o644, Size: 1},
+		},
+		Symlinks: []*tlc.Symlink{
+			&tlc.Symlink{Path: "latest", Mode: linkMode, Dest: "data/a.pak"},
+		},
+	}
+
+	c2 := &tlc.Container{
+		Dirs: []*tlc.Dir{
+			&tlc.Dir{Path: "data", Mode: dirMode},
+			&tlc.Dir{Path: "save", Mode: dirMode},
+		},
+		Files: []*tlc.File{
+			&tlc.File{Path: "game.exe", Mode: 0o755, Size: 120},
+			&tlc.File{Path: "data/a.pak", Mode: 0o644, Size: 10},
+			&tlc.File{Path: "data/b.pak", Mode: 0o644, Size: 20},
+		},
+		Symlinks: []*tlc.Symlink{
+			&tlc.Symlink{Path: "latest", Mode: linkMode, Dest: "data/b.pak"},
+		},
+	}
+
+	d := c1.Diff(c2)
+	d.Print(func(line string) {
+		t.Logf("%s", line)
+	})
+
+	assert.False(d.IsEmpty())
+	assert.EqualValues([]tlc.DiffEntry{
+		{Path: "data/b.pak", Type: tlc.EntryTypeFile, Mode: 0o644, Size: 20},
+	}, d.Added)
+	assert.EqualValues([]tlc.DiffEntry{
+		{Path: "old", Type: tlc.EntryTypeDir, Mode: dirMode},
+	}, d.Removed)
+	assert.EqualValues([]tlc.Resize{
+		{Path: "game.exe", OldSize: 100, NewSize: 120},
+	}, d.Resized)
+	assert.EqualValues([]tlc.ModeChange{
+		{Path: "game.exe", Type: tlc.EntryTypeFile, OldMode: 0o644, NewMode: 0o755},
+	}, d.ModeChanged)
+	assert.EqualValues([]tlc.TypeChange{
+		{Path: "save", OldType: tlc.EntryTypeFile, NewType: tlc.EntryTypeDir},
+	}, d.TypeChanged)
+	assert.EqualValues([]tlc.Retarget{
+		{Path: "latest", OldDest: "data/a.pak", NewDest: "data/b.pak"},
+	}, d.Retargeted)
+
+	payload, err := json.Marshal(d)
+	assert.NoError(err)
+	var decoded tlc.ContainerDiff
+	assert.NoError(json.Unmarshal(payload, &decoded))
+	assert.EqualValues(d, &decoded)
+
+	assert.True(c1.Diff(c1.Clone()).IsEmpty())
+	assert.EqualValues(len(d.Added), len(c2.Diff(c1).Removed))
+}
@@ -8,11 +8,38 @@ type Entry interface {
 
 	GetMode() uint32
 	SetMode(mode uint32)
+
+	GetMetadata() *Metadata
+	SetMetadata(metadata *Metadata)
 }
 
 var _ Entry = (*File)(nil)
 var _ Entry = (*Dir)(nil)
 var _ Entry = (*Symlink)(nil)
+var _ Entry = (*Hardlink)(nil)
+
+type EntryType string
+
+const (
+	EntryTypeFile     EntryType = "file"
+	EntryTypeDir      EntryType = "dir"
+	EntryTypeSymlink  EntryType = "symlink"
+	EntryTypeHardlink EntryType = "hardlink"
+)
+
+// EntryTypeOf returns whether an entry is a file, a directory, a symlink or a hardlink
+func EntryTypeOf(e Entry) EntryType {
+	switch e.(type) {
+	case *Dir:
+		return EntryTypeDir
+	case *Symlink:
+		return EntryTypeSymlink
+	case *Hardlink:
+		return EntryTypeHardlink
+	default:
+		return EntryTypeFile
+	}
+}
 
 //--------- File
 
@@ -32,6 +59,10 @@ func (f *File) SetMode(mode uint32) {
 	f.Mode = mode
 }
 
+func (f *File) SetMetadata(metadata *Metadata) {
+	f.Metadata = metadata
+}
+
 //--------- Symlink
 
 func (s *Symlink) GetPath() string {
@@ -50,6 +81,32 @@ func (s *Symlink) SetMode(mode uint32) {
 	s.Mode = mode
 }
 
+func (s *Symlink) SetMetadata(metadata *Metadata) {
+	s.Metadata = metadata
+}
+
+//--------- Hardlink
+
+func (h *Hardlink) GetPath() string {
+	return h.Path
+}
+
+func (h *Hardlink) SetPath(path string) {
+	h.Path = path
+}
+
+func (h *Hardlink) GetMode() uint32 {
+	return h.Mode
+}
+
+func (h *Hardlink) SetMode(mode uint32) {
+	h.Mode = mode
+}
+
+func (h *Hardlink) SetMetadata(metadata *Metadata) {
+	h.Metadata = metadata
+}
+
 //--------- Dir
 
 func (d *Dir) GetPath() string {
@@ -68,6 +125,10 @@ func (d *Dir) SetMode(mode uint32) {
 	d.Mode = mode
 }
 
+func (d *Dir) SetMetadata(metadata *Metadata) {
+	d.Metadata = metadata
+}
+
 //--------- Dir
 
 type ForEachOutcome int
@@ -95,6 +156,11 @@ func (c *Container) ForEachEntry(f func(e Entry) ForEachOutcome) {
 			return
 		}
 	}
+	for _, e := range c.Hardlinks {
+		if f(e) == ForEachBreak {
+			return
+		}
+	}
 }
 
 // Clone returns a deep clone of this container
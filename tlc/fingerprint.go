@@ -0,0 +1,241 @@
+package tlc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// A MerkleNode is an entry of a MerkleTree. The digest of a file covers
+// its permissions and content digest, the digest of a symlink (or hardlink)
+// covers its permissions and destination (or target), and the digest of a directory covers its
+// permissions and the names and digests of all its children.
+type MerkleNode struct {
+	Path     string
+	Type     EntryType
+	Digest   []byte
+	Children []*MerkleNode
+
+	mode uint32
+	dest string
+	file *File
+}
+
+// Name returns the last component of the node's path
+func (n *MerkleNode) Name() string {
+	return path.Base(n.Path)
+}
+
+// HexDigest returns the node's digest in hexadecimal form
+func (n *MerkleNode) HexDigest() string {
+	return hex.EncodeToString(n.Digest)
+}
+
+// A MerkleTree fingerprints a container. Two containers have the same
+// root digest if and only if they have the same paths, entry types,
+// permissions, symlink destinations and file contents, so subtrees can be
+// compared (and their digests used as cache keys) independently.
+type MerkleTree struct {
+	Root *MerkleNode
+
+	nodes map[string]*MerkleNode
+}
+
+// Lookup returns the node at a given path, or nil if there isn't one.
+// The root node has an empty path.
+func (t *MerkleTree) Lookup(p string) *MerkleNode {
+	return t.nodes[p]
+}
+
+// Fingerprint returns the hex-encoded root digest of the container, see
+// MerkleTree. All files need to have digests (see ComputeHashes).
+func (c *Container) Fingerprint() (string, error) {
+	tree, err := c.MerkleTree()
+	if err != nil {
+		return "", err
+	}
+	return tree.Root.HexDigest(), nil
+}
+
+// MerkleTree returns a Merkle tree of the container. All files need to have
+// digests (see ComputeHashes). Parent directories that are missing from
+// the container are treated as directories with no permission bits.
+func (c *Container) MerkleTree() (*MerkleTree, error) {
+	root := &MerkleNode{Path: "", Type: EntryTypeDir}
+	t := &MerkleTree{
+		Root:  root,
+		nodes: map[string]*MerkleNode{"": root},
+	}
+
+	var err error
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		err = t.insert(e)
+		if err != nil {
+			return ForEachBreak
+		}
+		return ForEachContinue
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	t.Root.computeDigest(h)
+	return t, nil
+}
+
+func (t *MerkleTree) insert(e Entry) error {
+	p := e.GetPath()
+	if err := ValidatePath(p); err != nil {
+		return err
+	}
+
+	n, ok := t.nodes[p]
+	if ok {
+		// only implicit directories may be made explicit
+		if n.Type != EntryTypeDir || EntryTypeOf(e) != EntryTypeDir || n.mode != 0 {
+			return errors.Errorf("duplicate path %s", p)
+		}
+	} else {
+		n = &MerkleNode{Path: p}
+		parent, err := t.parent(p)
+		if err != nil {
+			return err
+		}
+		parent.Children = append(parent.Children, n)
+		t.nodes[p] = n
+	}
+
+	n.Type = EntryTypeOf(e)
+	n.mode = uint32(os.FileMode(e.GetMode()) &^ os.ModeType)
+	switch e := e.(type) {
+	case *File:
+		if e.Digest == nil {
+			return errors.Errorf("file %s has no digest, call ComputeHashes first", p)
+		}
+		n.file = e
+	case *Symlink:
+		n.dest = e.Dest
+	case *Hardlink:
+		n.dest = e.Target
+	}
+	return nil
+}
+
+// parent returns the node for the parent directory of p,
+// creating it (and its own parents) if needed
+func (t *MerkleTree) parent(p string) (*MerkleNode, error) {
+	dir := path.Dir(p)
+	if dir == "." {
+		dir = ""
+	}
+
+	if n, ok := t.nodes[dir]; ok {
+		if n.Type != EntryTypeDir {
+			return nil, errors.Errorf("%s is a %s, can't contain %s", dir, n.Type, p)
+		}
+		return n, nil
+	}
+
+	grandParent, err := t.parent(dir)
+	if err != nil {
+		return nil, err
+	}
+	n := &MerkleNode{Path: dir, Type: EntryTypeDir}
+	grandParent.Children = append(grandParent.Children, n)
+	t.nodes[dir] = n
+	return n, nil
+}
+
+func (n *MerkleNode) computeDigest(h hash.Hash) {
+	if n.Type == EntryTypeDir {
+		sort.Slice(n.Children, func(i, j int) bool {
+			return n.Children[i].Name() < n.Children[j].Name()
+		})
+		for _, child := range n.Children {
+			child.computeDigest(h)
+		}
+	}
+
+	h.Reset()
+	writeField(h, []byte(n.Type))
+	var mode [4]byte
+	binary.BigEndian.PutUint32(mode[:], n.mode)
+	writeField(h, mode[:])
+
+	switch n.Type {
+	case EntryTypeFile:
+		writeField(h, []byte(n.file.Digest.Algorithm.String()))
+		writeField(h, n.file.Digest.Value)
+	case EntryTypeSymlink, EntryTypeHardlink:
+		writeField(h, []byte(n.dest))
+	case EntryTypeDir:
+		for _, child := range n.Children {
+			writeField(h, []byte(child.Name()))
+			writeField(h, child.Digest)
+		}
+	}
+	n.Digest = h.Sum(nil)
+}
+
+// writeField writes a length-prefixed field, so that
+// different sequences of fields can't hash the same
+func writeField(h hash.Hash, b []byte) {
+	var l [8]byte
+	binary.BigEndian.PutUint64(l[:], uint64(len(b)))
+	h.Write(l[:])
+	h.Write(b)
+}
+
+// ChangedPaths compares two Merkle trees and returns the topmost paths
+// whose digests differ, in walk order. Identical subtrees are skipped
+// entirely, and a path that only exists in one of the trees is returned
+// as-is, without listing its children.
+func (t *MerkleTree) ChangedPaths(other *MerkleTree) []string {
+	var res []string
+	var walk func(a *MerkleNode, b *MerkleNode)
+	walk = func(a *MerkleNode, b *MerkleNode) {
+		if bytes.Equal(a.Digest, b.Digest) {
+			return
+		}
+		if a.Type != EntryTypeDir || b.Type != EntryTypeDir || a.mode != b.mode {
+			res = append(res, a.Path)
+			return
+		}
+
+		names := make(map[string]bool)
+		for _, child := range a.Children {
+			names[child.Name()] = true
+		}
+		for _, child := range b.Children {
+			names[child.Name()] = true
+		}
+		var sortedNames []string
+		for name := range names {
+			sortedNames = append(sortedNames, name)
+		}
+		sort.Strings(sortedNames)
+
+		for _, name := range sortedNames {
+			p := name
+			if a.Path != "" {
+				p = a.Path + "/" + name
+			}
+			ca, cb := t.nodes[p], other.nodes[p]
+			if ca == nil || cb == nil {
+				res = append(res, p)
+				continue
+			}
+			walk(ca, cb)
+		}
+	}
+	walk(t.Root, other.Root)
+	return res
+}
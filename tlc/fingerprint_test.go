@@ -0,0 +1,91 @@
+package tlc_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Fingerprint(t *testing.T) {
+	assert := assert.New(t)
+
+	digest := func(b byte) *tlc.Digest {
+		return &tlc.Digest{Algorithm: tlc.HashAlgorithm_SHA256, Value: []byte{b}}
+	}
+
+	c := &tlc.Container{
+		Dirs: []*tlc.Dir{
+			{Path: "data", Mode: uint32(os.ModeDir | 0o755)},
+			{Path: "data/levels", Mode: uint32(os.ModeDir | 0o755)},
+		},
+		Files: []*tlc.File{
+			{Path: "game.exe", Mode: 0o755, Size: 1, Digest: digest(1)},
+			{Path: "data/levels/1.pak", Mode: 0o644, Size: 1, Digest: digest(2)},
+			{Path: "data/levels/2.pak", Mode: 0o644, Size: 1, Digest: digest(3)},
+			{Path: "docs/readme.txt", Mode: 0o644, Size: 1, Digest: digest(4)},
+		},
+		Symlinks: []*tlc.Symlink{
+			{Path: "data/latest.pak", Mode: 0o777, Dest: "levels/2.pak"},
+		},
+	}
+
+	fp, err := c.Fingerprint()
+	assert.NoError(err)
+	assert.Len(fp, 64)
+
+	// order of entries doesn't matter
+	shuffled := c.Clone()
+	shuffled.Files[0], shuffled.Files[3] = shuffled.Files[3], shuffled.Files[0]
+	shuffled.Dirs[0], shuffled.Dirs[1] = shuffled.Dirs[1], shuffled.Dirs[0]
+	fp2, err := shuffled.Fingerprint()
+	assert.NoError(err)
+	assert.EqualValues(fp, fp2)
+
+	tree, err := c.MerkleTree()
+	assert.NoError(err)
+	assert.NotNil(tree.Lookup("docs"), "implicit dirs are part of the tree")
+	assert.Nil(tree.Lookup("nope"))
+
+	mutations := map[string]func(c *tlc.Container){
+		"content": func(c *tlc.Container) { c.Files[1].Digest = digest(9) },
+		"mode":    func(c *tlc.Container) { c.Files[1].Mode = 0o600 },
+		"rename":  func(c *tlc.Container) { c.Files[1].Path = "data/levels/3.pak" },
+		"dest":    func(c *tlc.Container) { c.Symlinks[0].Dest = "levels/1.pak" },
+		"dirMode": func(c *tlc.Container) { c.Dirs[1].Mode = uint32(os.ModeDir | 0o700) },
+	}
+	for name, mutate := range mutations {
+		c2 := c.Clone()
+		mutate(c2)
+		tree2, err := c2.MerkleTree()
+		assert.NoError(err, name)
+		assert.NotEqual(tree.Root.Digest, tree2.Root.Digest, name)
+
+		// unrelated subtrees keep the same digests
+		assert.EqualValues(tree.Lookup("docs").Digest, tree2.Lookup("docs").Digest, name)
+		assert.EqualValues(tree.Lookup("game.exe").Digest, tree2.Lookup("game.exe").Digest, name)
+	}
+
+	c2 := c.Clone()
+	c2.Files[1].Digest = digest(9)
+	c2.Files[3].Path = "docs/README.txt"
+	tree2, err := c2.MerkleTree()
+	assert.NoError(err)
+	assert.EqualValues([]string{
+		"data/levels/1.pak",
+		"docs/README.txt",
+		"docs/readme.txt",
+	}, tree.ChangedPaths(tree2))
+	assert.Empty(tree.ChangedPaths(tree))
+
+	c3 := c.Clone()
+	c3.Files[0].Digest = nil
+	_, err = c3.Fingerprint()
+	assert.Error(err)
+
+	c4 := c.Clone()
+	c4.Files = append(c4.Files, &tlc.File{Path: "game.exe/nested", Digest: digest(1)})
+	_, err = c4.Fingerprint()
+	assert.Error(err)
+}
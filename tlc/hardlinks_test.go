@@ -0,0 +1,151 @@
+package tlc_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+	"github.com/itchio/lake/pools/fspool"
+	"github.com/itchio/lake/pools/zippool"
+	"github.com/itchio/lake/pools/zipwriterpool"
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Hardlinks(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("hardlink detection is only supported on linux and macOS")
+	}
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_hardlinks")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpPath)
+
+	src := filepath.Join(tmpPath, "src")
+	assert.NoError(os.MkdirAll(filepath.Join(src, "data"), 0o755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(src, "a.pak"), []byte("shared data"), 0o644))
+	assert.NoError(os.Link(filepath.Join(src, "a.pak"), filepath.Join(src, "data", "b.pak")))
+	assert.NoError(ioutil.WriteFile(filepath.Join(src, "c.pak"), []byte("shared data"), 0o644))
+
+	c, err := tlc.WalkDir(src, tlc.WalkOpts{})
+	assert.NoError(err)
+	assert.Len(c.Files, 3)
+	assert.Empty(c.Hardlinks)
+
+	c, err = tlc.WalkDir(src, tlc.WalkOpts{DetectHardlinks: true})
+	assert.NoError(err)
+	assert.Len(c.Files, 2)
+	assert.EqualValues(22, c.Size)
+	assert.Len(c.Hardlinks, 1)
+	assert.EqualValues("data/b.pak", c.Hardlinks[0].Path)
+	assert.EqualValues("a.pak", c.Hardlinks[0].Target)
+	assert.False(c.Report().HasErrors())
+
+	writeAll := func(c *tlc.Container, pool *fspool.FsPool) {
+		for i, f := range c.Files {
+			w, err := pool.GetWriter(int64(i))
+			assert.NoError(err)
+			contents, err := ioutil.ReadFile(filepath.Join(src, f.Path))
+			assert.NoError(err)
+			_, err = w.Write(contents)
+			assert.NoError(err)
+			assert.NoError(w.Close())
+		}
+	}
+
+	assertLinked := func(dst string) {
+		stats1, err := os.Stat(filepath.Join(dst, "a.pak"))
+		assert.NoError(err)
+		stats2, err := os.Stat(filepath.Join(dst, "data", "b.pak"))
+		assert.NoError(err)
+		assert.True(os.SameFile(stats1, stats2))
+		contents, err := ioutil.ReadFile(filepath.Join(dst, "data", "b.pak"))
+		assert.NoError(err)
+		assert.EqualValues("shared data", string(contents))
+	}
+
+	t.Logf("Preparing then writing")
+	dst := filepath.Join(tmpPath, "prepared")
+	assert.NoError(c.Prepare(dst))
+	writeAll(c, fspool.New(c, dst))
+	assertLinked(dst)
+
+	// a second write must not clobber files that used to be linked
+	c2 := c.Clone()
+	c2.Hardlinks = nil
+	c2.Files = append(c2.Files, &tlc.File{Path: "data/b.pak", Mode: 0o644, Size: 11, Offset: 22})
+	pool := fspool.New(c2, dst)
+	w, err := pool.GetWriter(2)
+	assert.NoError(err)
+	_, err = w.Write([]byte("other data!"))
+	assert.NoError(err)
+	assert.NoError(w.Close())
+	contents, err := ioutil.ReadFile(filepath.Join(dst, "a.pak"))
+	assert.NoError(err)
+	assert.EqualValues("shared data", string(contents))
+
+	t.Logf("Writing without preparing")
+	dst = filepath.Join(tmpPath, "written")
+	writeAll(c, fspool.New(c, dst))
+	assertLinked(dst)
+
+	t.Logf("Writing to a zip")
+	buf := new(bytes.Buffer)
+	zwp, err := zipwriterpool.New(c, zip.NewWriter(buf))
+	assert.NoError(err)
+	for i, f := range c.Files {
+		w, err := zwp.GetWriter(int64(i))
+		assert.NoError(err)
+		contents, err := ioutil.ReadFile(filepath.Join(src, f.Path))
+		assert.NoError(err)
+		_, err = w.Write(contents)
+		assert.NoError(err)
+		assert.NoError(w.Close())
+	}
+	assert.NoError(zwp.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(err)
+	zc, err := tlc.WalkZip(zr, tlc.WalkOpts{})
+	assert.NoError(err)
+	assert.Len(zc.Files, 3)
+	zp := zippool.New(zc, zr)
+	for i, f := range zc.Files {
+		r, err := zp.GetReader(int64(i))
+		assert.NoError(err)
+		contents, err := ioutil.ReadAll(r)
+		assert.NoError(err)
+		assert.EqualValues("shared data", string(contents), f.Path)
+	}
+}
+
+func Test_HardlinksValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &tlc.Container{
+		Files: []*tlc.File{
+			{Path: "a", Mode: 0o644},
+		},
+		Hardlinks: []*tlc.Hardlink{
+			{Path: "b", Mode: 0o644, Target: "a"},
+		},
+	}
+	assert.False(c.Report().HasErrors())
+
+	c.Hardlinks[0].Target = "nope"
+	report := c.Report()
+	assert.Len(report.Errors(), 1)
+	assert.EqualValues(tlc.IssueBadHardlink, report.Errors()[0].Kind)
+
+	c.Hardlinks[0].Target = "../../etc/passwd"
+	assert.Error(c.ValidatePaths())
+
+	c.Hardlinks[0].Path = "a"
+	c.Hardlinks[0].Target = "a"
+	assert.Error(c.Validate())
+}
@@ -0,0 +1,150 @@
+package tlc
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/itchio/lake"
+	"github.com/pkg/errors"
+)
+
+// hashChunkSize is how much we read from a pool at once when hashing
+const hashChunkSize = 256 * 1024
+
+// NewHasher returns a hash.Hash for the given algorithm
+func NewHasher(algo HashAlgorithm) (hash.Hash, error) {
+	switch algo {
+	case HashAlgorithm_SHA256:
+		return sha256.New(), nil
+	case HashAlgorithm_SHA1:
+		return sha1.New(), nil
+	}
+	return nil, errors.Errorf("unsupported hash algorithm %s", algo)
+}
+
+// Equal returns true if both digests use the same algorithm and have
+// the same value. Missing digests are never equal to anything.
+func (d *Digest) Equal(other *Digest) bool {
+	if d == nil || other == nil {
+		return false
+	}
+	return d.Algorithm == other.Algorithm && bytes.Equal(d.Value, other.Value)
+}
+
+// ToString returns a human-readable version of the digest, like `sha256:e3b0c442...`
+func (d *Digest) ToString() string {
+	if d == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%s:%s", strings.ToLower(d.Algorithm.String()), hex.EncodeToString(d.Value))
+}
+
+// comparableDigests returns true if both files have a digest, computed
+// with the same algorithm
+func comparableDigests(f1 *File, f2 *File) bool {
+	return f1.Digest != nil && f2.Digest != nil && f1.Digest.Algorithm == f2.Digest.Algorithm
+}
+
+// HasHashes returns true if all files of the container have a digest
+func (c *Container) HasHashes() bool {
+	for _, f := range c.Files {
+		if f.Digest == nil {
+			return false
+		}
+	}
+	return true
+}
+
+type hashJob struct {
+	file   *File
+	chunks chan []byte
+	// err is set before chunks is closed if the file couldn't be read
+	err error
+}
+
+// ComputeHashes reads all files from the pool and stores their digest.
+// Files are read one after the other (pools aren't safe for concurrent
+// use), but hashed in parallel, one goroutine per CPU core.
+//
+// Files that couldn't be read are left without a digest.
+func (c *Container) ComputeHashes(pool lake.Pool, algo HashAlgorithm) error {
+	// fail early if the algorithm is unsupported
+	_, err := NewHasher(algo)
+	if err != nil {
+		return err
+	}
+
+	jobs := make(chan *hashJob)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				h, _ := NewHasher(algo)
+				for chunk := range job.chunks {
+					h.Write(chunk)
+				}
+				if job.err != nil {
+					continue
+				}
+				job.file.Digest = &Digest{
+					Algorithm: algo,
+					Value:     h.Sum(nil),
+				}
+			}
+		}()
+	}
+
+	err = func() error {
+		defer close(jobs)
+
+		for index, f := range c.Files {
+			job := &hashJob{
+				file:   f,
+				chunks: make(chan []byte, 4),
+			}
+			jobs <- job
+
+			job.err = readChunks(pool, int64(index), job.chunks)
+			close(job.chunks)
+			if job.err != nil {
+				return errors.WithMessage(job.err, f.Path)
+			}
+		}
+		return nil
+	}()
+	wg.Wait()
+
+	return err
+}
+
+// readChunks sends the contents of a file to chunks
+func readChunks(pool lake.Pool, index int64, chunks chan []byte) error {
+	r, err := pool.GetReader(index)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for {
+		buf := make([]byte, hashChunkSize)
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			chunks <- buf[:n]
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+}
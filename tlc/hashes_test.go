@@ -0,0 +1,123 @@
+package tlc_test
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/itchio/lake/pools/fspool"
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ComputeHashes(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_hashes")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpPath)
+
+	contents := map[string]string{
+		"a.txt":     "hello",
+		"b/c.txt":   "world",
+		"empty.txt": "",
+		// bigger than a single chunk
+		"big.bin": strings.Repeat("0123456789", 100*1024),
+	}
+	for name, data := range contents {
+		p := filepath.Join(tmpPath, filepath.FromSlash(name))
+		assert.NoError(os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NoError(ioutil.WriteFile(p, []byte(data), 0o644))
+	}
+
+	c, err := tlc.WalkDir(tmpPath, tlc.WalkOpts{})
+	assert.NoError(err)
+	assert.False(c.HasHashes())
+
+	assert.NoError(c.ComputeHashes(fspool.New(c, tmpPath), tlc.HashAlgorithm_SHA256))
+	assert.True(c.HasHashes())
+	for _, f := range c.Files {
+		sum := sha256.Sum256([]byte(contents[f.Path]))
+		assert.EqualValues(tlc.HashAlgorithm_SHA256, f.Digest.Algorithm)
+		assert.EqualValues(sum[:], f.Digest.Value, f.Path)
+	}
+
+	// digests survive serialization
+	buf, err := proto.Marshal(c)
+	assert.NoError(err)
+	c2 := &tlc.Container{}
+	assert.NoError(proto.Unmarshal(buf, c2))
+	assert.True(c2.HasHashes())
+	assert.NoError(c.EnsureEqual(c2))
+	assert.True(c.Diff(c2).IsEmpty())
+
+	c3 := c.Clone()
+	assert.NoError(c3.ComputeHashes(fspool.New(c3, tmpPath), tlc.HashAlgorithm_SHA1))
+	sum := sha1.Sum([]byte("hello"))
+	assert.EqualValues("sha1:"+hex.EncodeToString(sum[:]), c3.Files[0].Digest.ToString())
+
+	// different algorithms can't be compared, so they're ignored
+	assert.NoError(c.EnsureEqual(c3))
+	assert.True(c.Diff(c3).IsEmpty())
+
+	assert.Error(c.ComputeHashes(fspool.New(c, tmpPath), tlc.HashAlgorithm_NONE))
+
+	// files that can't be read don't get a (wrong) digest
+	c4 := &tlc.Container{}
+	_, err = c4.AddFile("a.txt", 0o644, 5)
+	assert.NoError(err)
+	_, err = c4.AddFile("missing.txt", 0o644, 3)
+	assert.NoError(err)
+	pool := fspool.New(c4, tmpPath)
+	assert.Error(c4.ComputeHashes(pool, tlc.HashAlgorithm_SHA256))
+	assert.NotNil(c4.Files[0].Digest)
+	assert.Nil(c4.Files[1].Digest)
+
+	// the pool belongs to the caller
+	assert.NoError(pool.Close())
+}
+
+func Test_HashesDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_hashes_diff")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpPath)
+
+	write := func(root string, name string, contents string) {
+		p := filepath.Join(tmpPath, root, name)
+		assert.NoError(os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NoError(ioutil.WriteFile(p, []byte(contents), 0o644))
+	}
+	write("v1", "same.txt", "same")
+	write("v1", "changed.txt", "aaaa")
+	write("v2", "same.txt", "same")
+	write("v2", "changed.txt", "bbbb")
+
+	walk := func(root string) *tlc.Container {
+		c, err := tlc.WalkDir(filepath.Join(tmpPath, root), tlc.WalkOpts{})
+		assert.NoError(err)
+		return c
+	}
+	c1 := walk("v1")
+	c2 := walk("v2")
+
+	// without hashes, same-size changes go unnoticed
+	assert.NoError(c1.EnsureEqual(c2))
+	assert.True(c1.Diff(c2).IsEmpty())
+
+	assert.NoError(c1.ComputeHashes(fspool.New(c1, filepath.Join(tmpPath, "v1")), tlc.HashAlgorithm_SHA256))
+	assert.NoError(c2.ComputeHashes(fspool.New(c2, filepath.Join(tmpPath, "v2")), tlc.HashAlgorithm_SHA256))
+
+	assert.Error(c1.EnsureEqual(c2))
+	d := c1.Diff(c2)
+	assert.False(d.IsEmpty())
+	assert.Len(d.ContentChanged, 1)
+	assert.EqualValues("changed.txt", d.ContentChanged[0].Path)
+}
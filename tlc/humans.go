@@ -19,6 +19,10 @@ func (f *Symlink) ToString() string {
 	return fmt.Sprintf("%s %10s %s -> %s", os.FileMode(f.Mode), "-", f.Path, f.Dest)
 }
 
+func (f *Hardlink) ToString() string {
+	return fmt.Sprintf("%s %10s %s => %s", os.FileMode(f.Mode), "-", f.Path, f.Target)
+}
+
 type WriteLine func(line string)
 
 func (container *Container) Print(output WriteLine) {
@@ -28,7 +32,67 @@ func (container *Container) Print(output WriteLine) {
 	for _, f := range container.Symlinks {
 		output(f.ToString())
 	}
+	for _, f := range container.Hardlinks {
+		output(f.ToString())
+	}
 	for _, f := range container.Files {
 		output(f.ToString())
 	}
 }
+
+func (de DiffEntry) ToString() string {
+	switch de.Type {
+	case EntryTypeDir:
+		return fmt.Sprintf("%s %10s %s/", os.FileMode(de.Mode), "-", de.Path)
+	case EntryTypeSymlink:
+		return fmt.Sprintf("%s %10s %s -> %s", os.FileMode(de.Mode), "-", de.Path, de.Dest)
+	case EntryTypeHardlink:
+		return fmt.Sprintf("%s %10s %s => %s", os.FileMode(de.Mode), "-", de.Path, de.Dest)
+	default:
+		return fmt.Sprintf("%s %10s %s", os.FileMode(de.Mode), united.FormatBytes(de.Size), de.Path)
+	}
+}
+
+func (r Resize) ToString() string {
+	return fmt.Sprintf("%s: %s -> %s", r.Path, united.FormatBytes(r.OldSize), united.FormatBytes(r.NewSize))
+}
+
+func (cc ContentChange) ToString() string {
+	return fmt.Sprintf("%s: %s -> %s", cc.Path, cc.OldDigest, cc.NewDigest)
+}
+
+func (mc ModeChange) ToString() string {
+	return fmt.Sprintf("%s: %s -> %s", mc.Path, os.FileMode(mc.OldMode), os.FileMode(mc.NewMode))
+}
+
+func (tc TypeChange) ToString() string {
+	return fmt.Sprintf("%s: %s -> %s", tc.Path, tc.OldType, tc.NewType)
+}
+
+func (r Retarget) ToString() string {
+	return fmt.Sprintf("%s: -> %s (was -> %s)", r.Path, r.NewDest, r.OldDest)
+}
+
+func (d *ContainerDiff) Print(output WriteLine) {
+	for _, e := range d.Removed {
+		output("- " + e.ToString())
+	}
+	for _, e := range d.Added {
+		output("+ " + e.ToString())
+	}
+	for _, tc := range d.TypeChanged {
+		output("! " + tc.ToString())
+	}
+	for _, r := range d.Resized {
+		output("~ " + r.ToString())
+	}
+	for _, cc := range d.ContentChanged {
+		output("~ " + cc.ToString())
+	}
+	for _, mc := range d.ModeChanged {
+		output("~ " + mc.ToString())
+	}
+	for _, r := range d.Retargeted {
+		output("~ " + r.ToString())
+	}
+}
@@ -0,0 +1,264 @@
+package tlc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IgnoreFileName is the name of the ignore files WalkDir
+// reads when WalkOpts.IgnoreFiles is set
+const IgnoreFileName = ".itchignore"
+
+// An IgnoreRule is a single gitignore-style pattern
+type IgnoreRule struct {
+	// Pattern is the pattern as written
+	Pattern string
+	// Source is where the rule comes from (the container path of
+	// an ignore file, for example), and Line its line number there
+	Source string
+	Line   int
+
+	// Negate is set for patterns starting with '!': they re-include
+	// entries ignored by earlier rules
+	Negate bool
+	// DirOnly is set for patterns ending with '/'
+	DirOnly bool
+
+	// base is the directory the pattern is relative to
+	base     string
+	segments []string
+}
+
+func (r *IgnoreRule) String() string {
+	if r.Source == "" {
+		return r.Pattern
+	}
+	return fmt.Sprintf("%s:%d: %s", r.Source, r.Line, r.Pattern)
+}
+
+// Match returns true if the rule's pattern matches an entry, regardless
+// of whether it's negated. Entries outside of the directory the rule
+// is relative to never match.
+func (r *IgnoreRule) Match(entryPath string, isDir bool) bool {
+	if r.DirOnly && !isDir {
+		return false
+	}
+
+	rel := entryPath
+	if r.base != "" {
+		if !strings.HasPrefix(entryPath, r.base+"/") {
+			return false
+		}
+		rel = entryPath[len(r.base)+1:]
+	}
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches path components against pattern components,
+// where "**" matches any number of components
+func matchSegments(pattern []string, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				// a trailing "**" matches everything inside, not the directory itself
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(rest, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// parseIgnoreRule parses a line of an ignore file, and returns
+// nil if it's blank or a comment
+func parseIgnoreRule(line string, base string) (*IgnoreRule, error) {
+	line = strings.TrimRight(line, "\r")
+
+	// trailing spaces are ignored, unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return nil, nil
+	}
+
+	r := &IgnoreRule{Pattern: line, base: base}
+	if line[0] == '!' {
+		r.Negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.DirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil, errors.Errorf("empty pattern")
+	}
+
+	// patterns with a slash are relative to the base directory,
+	// others match at any depth
+	if strings.Contains(line, "/") {
+		line = strings.TrimPrefix(line, "/")
+		r.segments = strings.Split(line, "/")
+	} else {
+		r.segments = []string{"**", line}
+	}
+
+	for i, segment := range r.segments {
+		segment = negateBrackets(segment)
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, errors.Errorf("invalid pattern %q", r.Pattern)
+		}
+		r.segments[i] = segment
+	}
+	return r, nil
+}
+
+// negateBrackets turns gitignore's negated bracket expressions ("[!a-z]")
+// into what path.Match expects ("[^a-z]")
+func negateBrackets(segment string) string {
+	if !strings.Contains(segment, "[!") {
+		return segment
+	}
+
+	var sb strings.Builder
+	inClass := false
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		switch {
+		case c == '\\' && i+1 < len(segment):
+			sb.WriteByte(c)
+			i++
+			c = segment[i]
+		case c == '[' && !inClass:
+			inClass = true
+			if i+1 < len(segment) && segment[i+1] == '!' {
+				sb.WriteString("[^")
+				i++
+				continue
+			}
+		case c == ']' && inClass:
+			inClass = false
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// IgnoreRules is an ordered list of gitignore-style rules: for a given entry,
+// the last rule that matches decides whether it's ignored.
+//
+// The supported syntax is that of .gitignore files: blank lines and lines
+// starting with '#' are skipped, '!' negates a pattern, a trailing '/' only
+// matches directories, a pattern containing a '/' is anchored to the directory
+// the rules are relative to (otherwise it matches at any depth), '*', '?' and
+// '[...]' (negated with '[!...]') match within a path component, and "**"
+// matches any number of them.
+//
+// Like with git, contents of an ignored directory can't be re-included, since
+// walks skip ignored directories entirely.
+type IgnoreRules struct {
+	Rules []*IgnoreRule
+}
+
+// NewIgnoreRules parses patterns relative to the root of the container
+func NewIgnoreRules(patterns ...string) (*IgnoreRules, error) {
+	return ParseIgnoreRules(strings.NewReader(strings.Join(patterns, "\n")), "", "")
+}
+
+// ParseIgnoreRules parses an ignore file. Its patterns are relative to the
+// container directory base ("" for the root), and source is recorded in
+// every rule for error messages and reports.
+func ParseIgnoreRules(r io.Reader, base string, source string) (*IgnoreRules, error) {
+	ir := &IgnoreRules{}
+
+	s := bufio.NewScanner(r)
+	lineNumber := 0
+	for s.Scan() {
+		lineNumber++
+		rule, err := parseIgnoreRule(s.Text(), base)
+		if err != nil {
+			if source == "" {
+				return nil, errors.WithMessage(err, fmt.Sprintf("line %d", lineNumber))
+			}
+			return nil, errors.WithMessage(err, fmt.Sprintf("%s:%d", source, lineNumber))
+		}
+		if rule == nil {
+			continue
+		}
+		rule.Source = source
+		rule.Line = lineNumber
+		ir.Rules = append(ir.Rules, rule)
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ir, nil
+}
+
+// ReadIgnoreFile parses the ignore file at filePath, see ParseIgnoreRules
+func ReadIgnoreFile(filePath string, base string) (*IgnoreRules, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	return ParseIgnoreRules(f, base, filePath)
+}
+
+// Append adds rules after the existing ones, giving them precedence
+func (ir *IgnoreRules) Append(other *IgnoreRules) {
+	ir.Rules = append(ir.Rules, other.Rules...)
+}
+
+// Match returns the last rule that matches an entry, or nil if none do.
+// The entry is ignored if that rule isn't negated.
+func (ir *IgnoreRules) Match(entryPath string, isDir bool) *IgnoreRule {
+	for i := len(ir.Rules) - 1; i >= 0; i-- {
+		if ir.Rules[i].Match(entryPath, isDir) {
+			return ir.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Ignores returns true if an entry is ignored by the rules. It doesn't
+// check whether one of the entry's parent directories is ignored.
+func (ir *IgnoreRules) Ignores(entryPath string, isDir bool) bool {
+	rule := ir.Match(entryPath, isDir)
+	return rule != nil && !rule.Negate
+}
+
+// Filter returns an EntryFilterFunc that ignores entries like Ignores does
+func (ir *IgnoreRules) Filter() EntryFilterFunc {
+	return func(entry *FilterEntry) FilterResult {
+		if ir.Ignores(entry.Path, entry.Type == EntryTypeDir) {
+			return FilterIgnore
+		}
+		return FilterKeep
+	}
+}
@@ -0,0 +1,143 @@
+package tlc_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IgnoreRules(t *testing.T) {
+	assert := assert.New(t)
+
+	ir, err := tlc.NewIgnoreRules(
+		"# debug symbols",
+		"*.pdb",
+		"!keep.pdb",
+		"",
+		"/build/",
+		"docs/*.md",
+		"**/tmp/**",
+		"logs/**/*.log",
+		"trailing\\ ",
+		"\\#hash",
+	)
+	assert.NoError(err)
+	assert.Len(ir.Rules, 8)
+
+	ignored := func(p string, isDir bool) bool {
+		return ir.Ignores(p, isDir)
+	}
+
+	assert.True(ignored("game.pdb", false))
+	assert.True(ignored("bin/x64/game.pdb", false))
+	assert.False(ignored("bin/keep.pdb", false))
+	assert.False(ignored("game.exe", false))
+
+	assert.True(ignored("build", true))
+	assert.False(ignored("build", false))
+	assert.False(ignored("src/build", true))
+
+	assert.True(ignored("docs/README.md", false))
+	assert.False(ignored("docs/api/README.md", false))
+	assert.False(ignored("README.md", false))
+
+	assert.True(ignored("tmp/a", false))
+	assert.True(ignored("editor/tmp/a/b", false))
+	assert.False(ignored("editor/tmp", true))
+
+	assert.True(ignored("logs/a.log", false))
+	assert.True(ignored("logs/2020/03/a.log", false))
+	assert.False(ignored("other/a.log", false))
+
+	assert.True(ignored("trailing ", false))
+	assert.True(ignored("#hash", false))
+
+	rule := ir.Match("bin/keep.pdb", false)
+	assert.True(rule.Negate)
+	assert.EqualValues(3, rule.Line)
+	assert.EqualValues("!keep.pdb", rule.String())
+
+	sub, err := tlc.ParseIgnoreRules(strings.NewReader("*.txt\n/local\n"), "sub", "sub/.itchignore")
+	assert.NoError(err)
+	assert.True(sub.Ignores("sub/a.txt", false))
+	assert.True(sub.Ignores("sub/deep/a.txt", false))
+	assert.False(sub.Ignores("a.txt", false))
+	assert.True(sub.Ignores("sub/local", true))
+	assert.False(sub.Ignores("sub/deep/local", true))
+	assert.EqualValues("sub/.itchignore:2: /local", sub.Match("sub/local", false).String())
+
+	// bracket expressions are negated with '!', like in git
+	brackets, err := tlc.NewIgnoreRules("[!a]*.pdb", "\\[!x].log", "[^b]*.obj")
+	assert.NoError(err)
+	assert.True(brackets.Ignores("game.pdb", false))
+	assert.False(brackets.Ignores("assets.pdb", false))
+	assert.True(brackets.Ignores("[!x].log", false))
+	assert.False(brackets.Ignores("y.log", false))
+	assert.True(brackets.Ignores("main.obj", false))
+	assert.False(brackets.Ignores("build.obj", false))
+
+	_, err = tlc.NewIgnoreRules("ok", "[unterminated")
+	assert.Error(err)
+	assert.Contains(err.Error(), "line 2")
+}
+
+func Test_WalkIgnoreFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_ignore_files")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpPath)
+
+	write := func(name string, contents string) {
+		p := filepath.Join(tmpPath, filepath.FromSlash(name))
+		assert.NoError(os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NoError(ioutil.WriteFile(p, []byte(contents), 0o644))
+	}
+	write(".itchignore", "*.pdb\n.vs/\n")
+	write("game.exe", "x")
+	write("game.pdb", "x")
+	write(".vs/settings.json", "x")
+	write(".git/HEAD", "x")
+	write("plugins/.itchignore", "!needed.pdb\n/cache\n")
+	write("plugins/needed.pdb", "x")
+	write("plugins/other.pdb", "x")
+	write("plugins/cache/a", "x")
+	write("plugins/sub/cache/b", "x")
+	write("saves/slot1.sav", "x")
+
+	ir, err := tlc.NewIgnoreRules("saves/")
+	assert.NoError(err)
+
+	container, err := tlc.WalkDir(tmpPath, tlc.WalkOpts{
+		Filter:      tlc.PresetFilter,
+		IgnoreRules: ir,
+		IgnoreFiles: true,
+	})
+	assert.NoError(err)
+
+	var paths []string
+	container.ForEachEntry(func(e tlc.Entry) tlc.ForEachOutcome {
+		paths = append(paths, e.GetPath())
+		return tlc.ForEachContinue
+	})
+	sort.Strings(paths)
+	assert.EqualValues([]string{
+		"game.exe",
+		"plugins",
+		"plugins/needed.pdb",
+		"plugins/sub",
+		"plugins/sub/cache",
+		"plugins/sub/cache/b",
+	}, paths)
+
+	// without IgnoreFiles, ignore files are regular files
+	container, err = tlc.WalkDir(tmpPath, tlc.WalkOpts{Filter: tlc.PresetFilter})
+	assert.NoError(err)
+	assert.Len(container.Files, 10)
+}
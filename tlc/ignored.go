@@ -0,0 +1,124 @@
+package tlc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/itchio/headway/united"
+)
+
+type IgnoreReasonKind string
+
+const (
+	// IgnoredByPreset is for entries ignored by one of PresetFilter's patterns
+	IgnoredByPreset IgnoreReasonKind = "preset"
+	// IgnoredByFilter is for entries ignored by WalkOpts.Filter
+	// (other than PresetFilter's patterns)
+	IgnoredByFilter IgnoreReasonKind = "filter"
+	// IgnoredByEntryFilter is for entries ignored by WalkOpts.EntryFilter
+	IgnoredByEntryFilter IgnoreReasonKind = "entry-filter"
+	// IgnoredByRule is for entries ignored by WalkOpts.IgnoreRules
+	// or a rule from an ignore file
+	IgnoredByRule IgnoreReasonKind = "ignore-rule"
+	// IgnoredIgnoreFile is for ignore files themselves
+	IgnoredIgnoreFile IgnoreReasonKind = "ignore-file"
+)
+
+// An IgnoreReason tells why an entry was ignored. Rule is the
+// PresetFilter pattern or ignore rule responsible, if any.
+type IgnoreReason struct {
+	Kind IgnoreReasonKind `json:"kind"`
+	Rule string           `json:"rule,omitempty"`
+}
+
+func (ir IgnoreReason) ToString() string {
+	if ir.Rule == "" {
+		return string(ir.Kind)
+	}
+	return fmt.Sprintf("%s %s", ir.Kind, ir.Rule)
+}
+
+// An IgnoredEntry is an entry a walk excluded from the container. The size
+// of an ignored directory is the total size of the files in it.
+type IgnoredEntry struct {
+	Path   string       `json:"path"`
+	Type   EntryType    `json:"type"`
+	Size   int64        `json:"size"`
+	Reason IgnoreReason `json:"reason"`
+}
+
+// An IgnoreReport lists the entries a walk ignored, see WalkOpts.Ignored.
+// Only the topmost ignored directory is listed, not its contents.
+type IgnoreReport struct {
+	Entries []*IgnoredEntry `json:"entries"`
+	// TotalSize is the total size of all ignored files
+	TotalSize int64 `json:"totalSize"`
+
+	byPath map[string]*IgnoredEntry
+}
+
+func (r *IgnoreReport) add(fe *FilterEntry, reason *IgnoreReason) {
+	if _, ok := r.byPath[fe.Path]; ok {
+		return
+	}
+
+	ie := &IgnoredEntry{
+		Path:   fe.Path,
+		Type:   fe.Type,
+		Size:   fe.Size,
+		Reason: *reason,
+	}
+	r.Entries = append(r.Entries, ie)
+	r.TotalSize += ie.Size
+
+	if r.byPath == nil {
+		r.byPath = make(map[string]*IgnoredEntry)
+	}
+	r.byPath[ie.Path] = ie
+}
+
+// addSize adds the size of a file in an ignored directory
+func (r *IgnoreReport) addSize(dirPath string, size int64) {
+	if ie, ok := r.byPath[dirPath]; ok {
+		ie.Size += size
+		r.TotalSize += size
+	}
+}
+
+// Print writes a human-readable version of the report
+func (r *IgnoreReport) Print(output WriteLine) {
+	for _, ie := range r.Entries {
+		output(fmt.Sprintf("%-8s %10s %s (%s)", ie.Type, united.FormatBytes(ie.Size), ie.Path, ie.Reason.ToString()))
+	}
+	output(fmt.Sprintf("%d entries ignored, %s total", len(r.Entries), united.FormatBytes(r.TotalSize)))
+}
+
+// presetPattern returns the PresetFilter pattern that matches name, if any
+func presetPattern(name string) (string, bool) {
+	for _, pattern := range baseIgnoredPaths {
+		match, _ := filepath.Match(pattern, name)
+		if match {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// dirSize returns the total size of the regular files in a directory,
+// without following symlinks in it...
+func dirSize(dirPath string) int64 {
+	// ...except for the directory itself, when dereferencing
+	if resolved, err := filepath.EvalSymlinks(dirPath); err == nil {
+		dirPath = resolved
+	}
+
+	var size int64
+	filepath.Walk(dirPath, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,146 @@
+package tlc_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IgnoreReport(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_ignore_report")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpPath)
+
+	files := map[string]string{
+		".itchignore":          "*.pdb\n",
+		"game.exe":             "12345",
+		"game.pdb":             "123",
+		".git/HEAD":            "1234",
+		".git/objects/pack":    "123456",
+		"build/tmp/a":          "12",
+		"build/keep":           "1",
+		"huge.bin":             strings.Repeat("x", 100),
+		"Thumbs.db":            "1",
+		"plugins/.itchignore":  "!*.pdb\n",
+		"plugins/plugin.pdb":   "1",
+		"plugins/scratch/b.md": "123",
+	}
+	for name, contents := range files {
+		p := filepath.Join(tmpPath, filepath.FromSlash(name))
+		assert.NoError(os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NoError(ioutil.WriteFile(p, []byte(contents), 0o644))
+	}
+
+	rules, err := tlc.NewIgnoreRules("scratch/")
+	assert.NoError(err)
+
+	report := &tlc.IgnoreReport{}
+	opts := tlc.WalkOpts{
+		Filter: tlc.PresetFilter,
+		EntryFilter: func(entry *tlc.FilterEntry) tlc.FilterResult {
+			if entry.Path == "build/tmp" || entry.Size > 50 {
+				return tlc.FilterIgnore
+			}
+			return tlc.FilterKeep
+		},
+		IgnoreRules: rules,
+		IgnoreFiles: true,
+		Ignored:     report,
+	}
+
+	container, err := tlc.WalkDir(tmpPath, opts)
+	assert.NoError(err)
+	assert.Len(container.Files, 3)
+
+	reasons := make(map[string]tlc.IgnoreReason)
+	sizes := make(map[string]int64)
+	for _, ie := range report.Entries {
+		reasons[ie.Path] = ie.Reason
+		sizes[ie.Path] = ie.Size
+	}
+	assert.Len(report.Entries, 8)
+	assert.EqualValues(tlc.IgnoreReason{Kind: tlc.IgnoredIgnoreFile}, reasons[".itchignore"])
+	assert.EqualValues(tlc.IgnoreReason{Kind: tlc.IgnoredByPreset, Rule: ".git"}, reasons[".git"])
+	assert.EqualValues(10, sizes[".git"])
+	assert.EqualValues(tlc.IgnoreReason{Kind: tlc.IgnoredByPreset, Rule: "Thumbs.db"}, reasons["Thumbs.db"])
+	assert.EqualValues(tlc.IgnoreReason{Kind: tlc.IgnoredByEntryFilter}, reasons["build/tmp"])
+	assert.EqualValues(2, sizes["build/tmp"])
+	assert.EqualValues(tlc.IgnoreReason{Kind: tlc.IgnoredByEntryFilter}, reasons["huge.bin"])
+	assert.EqualValues(tlc.IgnoreReason{Kind: tlc.IgnoredByRule, Rule: ".itchignore:1: *.pdb"}, reasons["game.pdb"])
+	assert.EqualValues(tlc.IgnoreReason{Kind: tlc.IgnoredByRule, Rule: "scratch/"}, reasons["plugins/scratch"])
+	assert.EqualValues(tlc.IgnoreReason{Kind: tlc.IgnoredIgnoreFile}, reasons["plugins/.itchignore"])
+	assert.EqualValues(6+3+10+2+100+1+7+3, report.TotalSize)
+
+	var lines []string
+	report.Print(func(line string) { lines = append(lines, line) })
+	assert.Len(lines, 9)
+	assert.Contains(lines[8], "8 entries ignored")
+
+	// zips report the same things, except for ignore files
+	zipBuf := new(bytes.Buffer)
+	zw := zip.NewWriter(zipBuf)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		assert.NoError(err)
+		_, err = w.Write([]byte(contents))
+		assert.NoError(err)
+	}
+	assert.NoError(zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()))
+	assert.NoError(err)
+
+	opts.IgnoreFiles = false
+	opts.Ignored = &tlc.IgnoreReport{}
+	_, err = tlc.WalkZip(zr, opts)
+	assert.NoError(err)
+
+	sizes = make(map[string]int64)
+	for _, ie := range opts.Ignored.Entries {
+		sizes[ie.Path] = ie.Size
+	}
+	assert.EqualValues(map[string]int64{
+		".git":            10,
+		"Thumbs.db":       1,
+		"build/tmp":       2,
+		"huge.bin":        100,
+		"plugins/scratch": 3,
+	}, sizes)
+	assert.EqualValues(116, opts.Ignored.TotalSize)
+
+	// directory entries that come after their contents are only reported once
+	zipBuf = new(bytes.Buffer)
+	zw = zip.NewWriter(zipBuf)
+	for _, name := range []string{"x/y.txt", "x/", "x/z.txt", "keep.txt"} {
+		w, err := zw.Create(name)
+		assert.NoError(err)
+		if !strings.HasSuffix(name, "/") {
+			_, err = w.Write([]byte("ab"))
+			assert.NoError(err)
+		}
+	}
+	assert.NoError(zw.Close())
+
+	zr, err = zip.NewReader(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()))
+	assert.NoError(err)
+
+	rules, err = tlc.NewIgnoreRules("x/")
+	assert.NoError(err)
+	report = &tlc.IgnoreReport{}
+	container, err = tlc.WalkZip(zr, tlc.WalkOpts{IgnoreRules: rules, Ignored: report})
+	assert.NoError(err)
+	assert.Len(container.Files, 1)
+	assert.Len(report.Entries, 1)
+	assert.EqualValues("x", report.Entries[0].Path)
+	assert.EqualValues(4, report.Entries[0].Size)
+	assert.EqualValues(4, report.TotalSize)
+}
@@ -0,0 +1,269 @@
+package tlc
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// An Index is a view of a container that answers path queries without
+// scanning it: finding an entry by path, listing the contents of a
+// directory or a whole subtree, and computing the total size of files
+// in a directory.
+//
+// Directories that aren't in the container but have entries in them
+// (including the root, whose path is "") are part of the tree, with
+// no corresponding entry.
+//
+// The index is rebuilt automatically after changes made through the
+// mutation API (AddFile, Remove, Move, etc.). Other changes are only
+// noticed if they change the length of one of the container's slices or
+// replace it: changing the path of an entry in place, or removing an entry
+// then appending another one to the same slice, isn't detected. Call
+// Rebuild after doing that.
+type Index struct {
+	c   *Container
+	sig indexSignature
+
+	nodes  map[string]*indexNode
+	sorted []string
+}
+
+type indexNode struct {
+	entry    Entry
+	index    int
+	children []string
+	size     int64
+}
+
+// indexSignature is used to tell (cheaply) whether a container was modified
+// since its index was built
+type indexSignature struct {
+	size                             int64
+	files, dirs, symlinks, hardlinks int
+
+	filesP     **File
+	dirsP      **Dir
+	symlinksP  **Symlink
+	hardlinksP **Hardlink
+}
+
+func signatureOf(c *Container) indexSignature {
+	sig := indexSignature{
+		size:      c.Size,
+		files:     len(c.Files),
+		dirs:      len(c.Dirs),
+		symlinks:  len(c.Symlinks),
+		hardlinks: len(c.Hardlinks),
+	}
+	// a new backing array means the slice was rebuilt
+	if len(c.Files) > 0 {
+		sig.filesP = &c.Files[0]
+	}
+	if len(c.Dirs) > 0 {
+		sig.dirsP = &c.Dirs[0]
+	}
+	if len(c.Symlinks) > 0 {
+		sig.symlinksP = &c.Symlinks[0]
+	}
+	if len(c.Hardlinks) > 0 {
+		sig.hardlinksP = &c.Hardlinks[0]
+	}
+	return sig
+}
+
+// NewIndex returns an index of the container
+func NewIndex(c *Container) *Index {
+	idx := &Index{c: c}
+	idx.Rebuild()
+	return idx
+}
+
+// Stale returns true if the container was modified since the index was
+// built, as far as it can tell (see Index).
+func (idx *Index) Stale() bool {
+	return idx.sig != signatureOf(idx.c)
+}
+
+// Rebuild indexes the container again
+func (idx *Index) Rebuild() {
+	idx.sig = signatureOf(idx.c)
+	idx.nodes = map[string]*indexNode{"": {}}
+	idx.sorted = nil
+
+	add := func(e Entry, i int) {
+		p := e.GetPath()
+		n, ok := idx.nodes[p]
+		if ok {
+			if n.entry != nil {
+				// duplicate path, keep the first one
+				return
+			}
+		} else {
+			n = &indexNode{}
+			idx.nodes[p] = n
+			idx.attach(p)
+		}
+		n.entry = e
+		n.index = i
+	}
+	for i, d := range idx.c.Dirs {
+		add(d, i)
+	}
+	for i, f := range idx.c.Files {
+		add(f, i)
+	}
+	for i, s := range idx.c.Symlinks {
+		add(s, i)
+	}
+	for i, h := range idx.c.Hardlinks {
+		add(h, i)
+	}
+
+	for p, n := range idx.nodes {
+		if p != "" {
+			idx.sorted = append(idx.sorted, p)
+		}
+		sort.Strings(n.children)
+	}
+	sort.Strings(idx.sorted)
+
+	for _, f := range idx.c.Files {
+		if idx.nodes[f.Path].entry != Entry(f) {
+			continue
+		}
+		for p := f.Path; p != ""; {
+			p = parentPath(p)
+			idx.nodes[p].size += f.Size
+		}
+	}
+}
+
+// attach adds p to its parent's children, creating parents as needed
+func (idx *Index) attach(p string) {
+	parent := parentPath(p)
+	pn, ok := idx.nodes[parent]
+	if !ok {
+		pn = &indexNode{}
+		idx.nodes[parent] = pn
+		idx.attach(parent)
+	}
+	pn.children = append(pn.children, p)
+}
+
+func parentPath(p string) string {
+	parent := path.Dir(p)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
+
+func (idx *Index) refresh() {
+	if idx.Stale() {
+		idx.Rebuild()
+	}
+}
+
+func (idx *Index) node(p string) *indexNode {
+	idx.refresh()
+	return idx.nodes[p]
+}
+
+// Exists returns true if p is an entry of the container,
+// or a directory containing entries.
+func (idx *Index) Exists(p string) bool {
+	return idx.node(p) != nil
+}
+
+// Lookup returns the entry at p, or nil if there isn't one
+func (idx *Index) Lookup(p string) Entry {
+	n := idx.node(p)
+	if n == nil {
+		return nil
+	}
+	return n.entry
+}
+
+func (idx *Index) lookupIndex(p string, typ EntryType) (int, bool) {
+	n := idx.node(p)
+	if n == nil || n.entry == nil || EntryTypeOf(n.entry) != typ {
+		return 0, false
+	}
+	return n.index, true
+}
+
+// FileIndex returns the index in Container.Files of the file at p
+func (idx *Index) FileIndex(p string) (int, bool) {
+	return idx.lookupIndex(p, EntryTypeFile)
+}
+
+// DirIndex returns the index in Container.Dirs of the directory at p
+func (idx *Index) DirIndex(p string) (int, bool) {
+	return idx.lookupIndex(p, EntryTypeDir)
+}
+
+// SymlinkIndex returns the index in Container.Symlinks of the symlink at p
+func (idx *Index) SymlinkIndex(p string) (int, bool) {
+	return idx.lookupIndex(p, EntryTypeSymlink)
+}
+
+// HardlinkIndex returns the index in Container.Hardlinks of the hardlink at p
+func (idx *Index) HardlinkIndex(p string) (int, bool) {
+	return idx.lookupIndex(p, EntryTypeHardlink)
+}
+
+// Parent returns the path of the directory containing p, and false
+// if p isn't in the index or is the root.
+func (idx *Index) Parent(p string) (string, bool) {
+	if p == "" || idx.node(p) == nil {
+		return "", false
+	}
+	return parentPath(p), true
+}
+
+// Children returns the sorted paths of the entries directly in p
+func (idx *Index) Children(p string) []string {
+	n := idx.node(p)
+	if n == nil {
+		return nil
+	}
+	return append([]string(nil), n.children...)
+}
+
+// Subtree returns the sorted paths of all the entries in p,
+// recursively, not including p itself.
+func (idx *Index) Subtree(p string) []string {
+	if p == "" {
+		idx.refresh()
+		return append([]string(nil), idx.sorted...)
+	}
+	return idx.WithPrefix(p + "/")
+}
+
+// WithPrefix returns the sorted paths of all entries that start with
+// prefix. Unlike Subtree, the prefix doesn't have to end at a path separator.
+func (idx *Index) WithPrefix(prefix string) []string {
+	idx.refresh()
+	var res []string
+	for i := sort.SearchStrings(idx.sorted, prefix); i < len(idx.sorted); i++ {
+		if !strings.HasPrefix(idx.sorted[i], prefix) {
+			break
+		}
+		res = append(res, idx.sorted[i])
+	}
+	return res
+}
+
+// Size returns the size of the file at p, or the total size
+// of all files in the directory at p, recursively.
+func (idx *Index) Size(p string) int64 {
+	n := idx.node(p)
+	if n == nil {
+		return 0
+	}
+	if f, ok := n.entry.(*File); ok {
+		return f.Size
+	}
+	return n.size
+}
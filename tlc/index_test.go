@@ -0,0 +1,68 @@
+package tlc_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Index(t *testing.T) {
+	assert := assert.New(t)
+
+	c := exportTestContainer()
+	c.Files = append(c.Files, &tlc.File{Path: "assets/sounds/boom.ogg", Mode: 0o644, Size: 100, Offset: c.Size})
+	c.Size += 100
+
+	idx := tlc.NewIndex(c)
+
+	i, ok := idx.FileIndex("game.exe")
+	assert.True(ok)
+	assert.EqualValues("game.exe", c.Files[i].Path)
+	_, ok = idx.FileIndex("data")
+	assert.False(ok)
+	i, ok = idx.DirIndex("data")
+	assert.True(ok)
+	assert.EqualValues(0, i)
+	_, ok = idx.SymlinkIndex("data/latest.pak")
+	assert.True(ok)
+	_, ok = idx.HardlinkIndex("data/copy.pak")
+	assert.True(ok)
+
+	// implicit directories
+	assert.True(idx.Exists("assets/sounds"))
+	assert.Nil(idx.Lookup("assets/sounds"))
+	assert.False(idx.Exists("nope"))
+
+	parent, ok := idx.Parent("assets/sounds/boom.ogg")
+	assert.True(ok)
+	assert.EqualValues("assets/sounds", parent)
+	parent, ok = idx.Parent("game.exe")
+	assert.True(ok)
+	assert.EqualValues("", parent)
+	_, ok = idx.Parent("")
+	assert.False(ok)
+
+	assert.EqualValues([]string{"assets", "data", "game.exe"}, idx.Children(""))
+	assert.EqualValues([]string{"data/copy.pak", "data/latest.pak", "data/level1.pak"}, idx.Children("data"))
+	assert.EqualValues([]string{"assets/sounds", "assets/sounds/boom.ogg"}, idx.Subtree("assets"))
+	assert.EqualValues([]string{"data/latest.pak", "data/level1.pak"}, idx.WithPrefix("data/l"))
+	assert.Len(idx.Subtree(""), 8)
+
+	assert.EqualValues(116, idx.Size(""))
+	assert.EqualValues(11, idx.Size("data"))
+	assert.EqualValues(100, idx.Size("assets"))
+	assert.EqualValues(5, idx.Size("game.exe"))
+
+	// the index follows changes to the container
+	assert.False(idx.Stale())
+	c.Dirs = append(c.Dirs, &tlc.Dir{Path: "saves", Mode: uint32(os.ModeDir | 0o755)})
+	assert.True(idx.Stale())
+	assert.True(idx.Exists("saves"))
+	assert.False(idx.Stale())
+
+	c.Files = c.Files[1:]
+	assert.False(idx.Exists("data/level1.pak"))
+	assert.EqualValues(0, idx.Size("data"))
+}
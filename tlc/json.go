@@ -0,0 +1,468 @@
+package tlc
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// jsonDir, jsonFile, jsonSymlink and jsonHardlink are how entries are
+// represented in JSON and YAML. Field names are part of the format and
+// must not change. Modes are written like in manifests (see WriteManifest).
+type jsonDir struct {
+	Path     string        `json:"path" yaml:"path"`
+	Mode     string        `json:"mode" yaml:"mode"`
+	Metadata *jsonMetadata `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+type jsonFile struct {
+	Path         string        `json:"path" yaml:"path"`
+	Mode         string        `json:"mode" yaml:"mode"`
+	Size         int64         `json:"size" yaml:"size"`
+	Digest       string        `json:"digest,omitempty" yaml:"digest,omitempty"`
+	OriginalPath string        `json:"originalPath,omitempty" yaml:"originalPath,omitempty"`
+	Metadata     *jsonMetadata `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+type jsonSymlink struct {
+	Path     string        `json:"path" yaml:"path"`
+	Mode     string        `json:"mode" yaml:"mode"`
+	Dest     string        `json:"dest" yaml:"dest"`
+	Metadata *jsonMetadata `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+type jsonHardlink struct {
+	Path     string        `json:"path" yaml:"path"`
+	Mode     string        `json:"mode" yaml:"mode"`
+	Target   string        `json:"target" yaml:"target"`
+	Metadata *jsonMetadata `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+type jsonMetadata struct {
+	// RFC 3339, with nanoseconds
+	Mtime  string       `json:"mtime,omitempty" yaml:"mtime,omitempty"`
+	Owner  *jsonOwner   `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Xattrs []*jsonXattr `json:"xattrs,omitempty" yaml:"xattrs,omitempty"`
+}
+
+type jsonOwner struct {
+	Uid uint32 `json:"uid" yaml:"uid"`
+	Gid uint32 `json:"gid" yaml:"gid"`
+}
+
+type jsonXattr struct {
+	Name string `json:"name" yaml:"name"`
+	// base64-encoded
+	Value string `json:"value" yaml:"value"`
+}
+
+type jsonContainer struct {
+	Size      *int64          `json:"size" yaml:"size"`
+	Dirs      []*jsonDir      `json:"dirs" yaml:"dirs"`
+	Files     []*jsonFile     `json:"files" yaml:"files"`
+	Symlinks  []*jsonSymlink  `json:"symlinks" yaml:"symlinks"`
+	Hardlinks []*jsonHardlink `json:"hardlinks" yaml:"hardlinks"`
+}
+
+func toJSONEntry(e Entry) interface{} {
+	mode := formatManifestMode(e)
+	metadata := toJSONMetadata(e.GetMetadata())
+
+	switch e := e.(type) {
+	case *Dir:
+		return &jsonDir{Path: e.Path, Mode: mode, Metadata: metadata}
+	case *Symlink:
+		return &jsonSymlink{Path: e.Path, Mode: mode, Dest: e.Dest, Metadata: metadata}
+	case *Hardlink:
+		return &jsonHardlink{Path: e.Path, Mode: mode, Target: e.Target, Metadata: metadata}
+	case *File:
+		jf := &jsonFile{Path: e.Path, Mode: mode, Size: e.Size, OriginalPath: e.OriginalPath, Metadata: metadata}
+		if e.Digest != nil {
+			jf.Digest = e.Digest.ToString()
+		}
+		return jf
+	}
+	return nil
+}
+
+func toJSONMetadata(m *Metadata) *jsonMetadata {
+	if m == nil {
+		return nil
+	}
+
+	jm := &jsonMetadata{}
+	if m.Mtime != 0 {
+		jm.Mtime = time.Unix(0, m.Mtime).UTC().Format(time.RFC3339Nano)
+	}
+	if m.Owner != nil {
+		jm.Owner = &jsonOwner{Uid: m.Owner.Uid, Gid: m.Owner.Gid}
+	}
+	for _, x := range m.Xattrs {
+		jm.Xattrs = append(jm.Xattrs, &jsonXattr{Name: x.Name, Value: base64.StdEncoding.EncodeToString(x.Value)})
+	}
+	return jm
+}
+
+func (jm *jsonMetadata) toMetadata() (*Metadata, error) {
+	if jm == nil {
+		return nil, nil
+	}
+
+	m := &Metadata{}
+	if jm.Mtime != "" {
+		mtime, err := time.Parse(time.RFC3339Nano, jm.Mtime)
+		if err != nil {
+			return nil, errors.Errorf("invalid mtime %q", jm.Mtime)
+		}
+		m.Mtime = mtime.UnixNano()
+	}
+	if jm.Owner != nil {
+		m.Owner = &Ownership{Uid: jm.Owner.Uid, Gid: jm.Owner.Gid}
+	}
+	for _, jx := range jm.Xattrs {
+		value, err := base64.StdEncoding.DecodeString(jx.Value)
+		if err != nil {
+			return nil, errors.Errorf("invalid value for xattr %s", jx.Name)
+		}
+		m.Xattrs = append(m.Xattrs, &Xattr{Name: jx.Name, Value: value})
+	}
+	return m, nil
+}
+
+func (jd *jsonDir) toEntry() (Entry, error) {
+	mode, err := parseManifestMode(jd.Mode, EntryTypeDir)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := jd.Metadata.toMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return &Dir{Path: jd.Path, Mode: mode, Metadata: metadata}, nil
+}
+
+func (jf *jsonFile) toEntry() (Entry, error) {
+	mode, err := parseManifestMode(jf.Mode, EntryTypeFile)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := jf.Metadata.toMetadata()
+	if err != nil {
+		return nil, err
+	}
+	f := &File{Path: jf.Path, Mode: mode, Size: jf.Size, OriginalPath: jf.OriginalPath, Metadata: metadata}
+	if jf.Digest != "" {
+		f.Digest, err = parseDigest(jf.Digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (js *jsonSymlink) toEntry() (Entry, error) {
+	mode, err := parseManifestMode(js.Mode, EntryTypeSymlink)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := js.Metadata.toMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return &Symlink{Path: js.Path, Mode: mode, Dest: js.Dest, Metadata: metadata}, nil
+}
+
+func (jh *jsonHardlink) toEntry() (Entry, error) {
+	mode, err := parseManifestMode(jh.Mode, EntryTypeHardlink)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := jh.Metadata.toMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return &Hardlink{Path: jh.Path, Mode: mode, Target: jh.Target, Metadata: metadata}, nil
+}
+
+// addEntry appends an entry to the right list of a container,
+// and updates its size and the entry's offset if it's a file
+func (c *Container) addEntry(e Entry) {
+	switch e := e.(type) {
+	case *Dir:
+		c.Dirs = append(c.Dirs, e)
+	case *File:
+		e.Offset = c.Size
+		c.Size += e.Size
+		c.Files = append(c.Files, e)
+	case *Symlink:
+		c.Symlinks = append(c.Symlinks, e)
+	case *Hardlink:
+		c.Hardlinks = append(c.Hardlinks, e)
+	}
+}
+
+// WriteJSON writes the container as JSON, with one entry per line so the
+// output stays diffable. Modes are strings in octal, like in manifests (see
+// WriteManifest), and file offsets are omitted since they're derived from
+// file sizes when reading back.
+//
+// WriteJSON and ReadJSON are the supported JSON format for containers.
+// Container deliberately doesn't implement json.Marshaler: encoding/json
+// (on a container, or on a struct embedding one) keeps producing the
+// protobuf field names and decimal modes that existing consumers of
+// JSON-serialized containers rely on.
+func (c *Container) WriteJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	_, err := fmt.Fprintf(bw, "{\"size\":%d", c.Size)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	writeList := func(key string, n int, entry func(i int) Entry) error {
+		_, err := fmt.Fprintf(bw, ",\n%q:[", key)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			sep := ",\n"
+			if i == 0 {
+				sep = "\n"
+			}
+			line, err := json.Marshal(toJSONEntry(entry(i)))
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(bw, "%s%s", sep, line)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = bw.WriteString("]")
+		return err
+	}
+
+	err = writeList("dirs", len(c.Dirs), func(i int) Entry { return c.Dirs[i] })
+	if err == nil {
+		err = writeList("files", len(c.Files), func(i int) Entry { return c.Files[i] })
+	}
+	if err == nil {
+		err = writeList("symlinks", len(c.Symlinks), func(i int) Entry { return c.Symlinks[i] })
+	}
+	if err == nil {
+		err = writeList("hardlinks", len(c.Hardlinks), func(i int) Entry { return c.Hardlinks[i] })
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = bw.WriteString("}\n")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(bw.Flush())
+}
+
+// ReadJSON parses the output of WriteJSON, and returns an error
+// if the container has any issues of severity error (see Report).
+func ReadJSON(r io.Reader) (*Container, error) {
+	c := &Container{}
+	dec := NewJSONDecoder(r)
+	for {
+		e, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.addEntry(e)
+	}
+
+	err := c.Report().Err()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// A JSONDecoder reads the entries of a container written by WriteJSON one
+// by one, so that very large containers don't need to be held in memory.
+//
+// It can't run all the checks ReadJSON does, but it does reject unsafe paths
+// (see ValidatePath), duplicate paths, and files with a negative size.
+type JSONDecoder struct {
+	dec *json.Decoder
+
+	started  bool
+	listType EntryType
+	offset   int64
+	size     int64
+	hasSize  bool
+	seen     map[string]bool
+}
+
+// NewJSONDecoder returns a decoder that reads from r
+func NewJSONDecoder(r io.Reader) *JSONDecoder {
+	return &JSONDecoder{
+		dec:  json.NewDecoder(r),
+		seen: make(map[string]bool),
+	}
+}
+
+// Next returns the next entry of the container, in the order they were
+// written. File offsets are filled in. It returns io.EOF when there are
+// no entries left.
+func (d *JSONDecoder) Next() (Entry, error) {
+	e, err := d.next()
+	if err != nil && err != io.EOF {
+		return nil, errors.WithMessage(err, "while decoding container")
+	}
+	return e, err
+}
+
+func (d *JSONDecoder) next() (Entry, error) {
+	if !d.started {
+		err := d.expectDelim('{')
+		if err != nil {
+			return nil, err
+		}
+		d.started = true
+	}
+
+	for d.listType == "" {
+		if !d.dec.More() {
+			err := d.expectDelim('}')
+			if err != nil {
+				return nil, err
+			}
+			if d.hasSize && d.size != d.offset {
+				return nil, errors.Errorf("container size is %d, but its files add up to %d", d.size, d.offset)
+			}
+			return nil, io.EOF
+		}
+
+		tok, err := d.dec.Token()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		switch tok {
+		case "size":
+			err := d.dec.Decode(&d.size)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			d.hasSize = true
+			continue
+		case "dirs":
+			d.listType = EntryTypeDir
+		case "files":
+			d.listType = EntryTypeFile
+		case "symlinks":
+			d.listType = EntryTypeSymlink
+		case "hardlinks":
+			d.listType = EntryTypeHardlink
+		default:
+			return nil, errors.Errorf("unknown key %v", tok)
+		}
+
+		tok, err = d.dec.Token()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if tok == nil {
+			// lists may be null
+			d.listType = ""
+		} else if tok != json.Delim('[') {
+			return nil, errors.Errorf("expected list of %ss, got %v", d.listType, tok)
+		}
+	}
+
+	if !d.dec.More() {
+		err := d.expectDelim(']')
+		if err != nil {
+			return nil, err
+		}
+		d.listType = ""
+		return d.next()
+	}
+
+	var je interface {
+		toEntry() (Entry, error)
+	}
+	switch d.listType {
+	case EntryTypeDir:
+		je = &jsonDir{}
+	case EntryTypeFile:
+		je = &jsonFile{}
+	case EntryTypeSymlink:
+		je = &jsonSymlink{}
+	case EntryTypeHardlink:
+		je = &jsonHardlink{}
+	}
+
+	err := d.dec.Decode(je)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	e, err := je.toEntry()
+	if err != nil {
+		return nil, err
+	}
+
+	if f, ok := e.(*File); ok {
+		f.Offset = d.offset
+		d.offset += f.Size
+	}
+
+	err = d.check(e)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (d *JSONDecoder) check(e Entry) error {
+	p := e.GetPath()
+	err := ValidatePath(p)
+	if err != nil {
+		return err
+	}
+	if h, ok := e.(*Hardlink); ok {
+		err := ValidatePath(h.Target)
+		if err != nil {
+			return errors.WithMessage(err, "invalid hardlink target")
+		}
+	}
+
+	if d.seen[p] {
+		return errors.Errorf("duplicate path %s", p)
+	}
+	d.seen[p] = true
+
+	if f, ok := e.(*File); ok && f.Size < 0 {
+		return errors.Errorf("file %s has negative size %d", p, f.Size)
+	}
+	return nil
+}
+
+func (d *JSONDecoder) expectDelim(delim json.Delim) error {
+	tok, err := d.dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return errors.Errorf("unexpected end of input, expected %v", delim)
+		}
+		return errors.WithStack(err)
+	}
+	if tok != delim {
+		return errors.Errorf("expected %v, got %v", delim, tok)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package tlc_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func exportTestContainer() *tlc.Container {
+	c := &tlc.Container{
+		Dirs: []*tlc.Dir{
+			{Path: "data", Mode: uint32(os.ModeDir | 0o755)},
+		},
+		Files: []*tlc.File{
+			{
+				Path: "data/level1.pak", Mode: 0o644, Size: 11,
+				Digest: &tlc.Digest{Algorithm: tlc.HashAlgorithm_SHA1, Value: []byte{0xca, 0xfe}},
+				Metadata: &tlc.Metadata{
+					Mtime:  1583075045123456789,
+					Owner:  &tlc.Ownership{Uid: 1000, Gid: 100},
+					Xattrs: []*tlc.Xattr{{Name: "user.bin", Value: []byte{0, 1, 2}}},
+				},
+			},
+			{Path: "game.exe", Mode: 0o755 | uint32(os.ModeSetuid), Size: 5},
+		},
+		Symlinks: []*tlc.Symlink{
+			{Path: "data/latest.pak", Mode: uint32(os.ModeSymlink | 0o777), Dest: "level1.pak"},
+		},
+		Hardlinks: []*tlc.Hardlink{
+			{Path: "data/copy.pak", Mode: 0o644, Target: "data/level1.pak"},
+		},
+	}
+	c.Normalize()
+	return c
+}
+
+func Test_JSON(t *testing.T) {
+	assert := assert.New(t)
+
+	c := exportTestContainer()
+
+	buf := new(bytes.Buffer)
+	assert.NoError(c.WriteJSON(buf))
+	s := buf.String()
+	assert.Contains(s, `{"path":"data","mode":"0755"}`)
+	assert.Contains(s, `{"path":"game.exe","mode":"4755","size":5}`)
+	assert.Contains(s, `"digest":"sha1:cafe"`)
+	assert.Contains(s, `"mtime":"2020-03-01T15:04:05.123456789Z"`)
+	assert.Contains(s, `{"path":"data/copy.pak","mode":"0644","target":"data/level1.pak"}`)
+	assert.NotContains(s, "offset")
+
+	c2, err := tlc.ReadJSON(bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+	assert.True(proto.Equal(c, c2), "json should round-trip")
+
+	// encoding/json keeps using the struct fields, so containers
+	// serialized before WriteJSON existed can still be read
+	var c3 tlc.Container
+	assert.NoError(json.Unmarshal([]byte(`{"files":[{"path":"a","mode":420,"size":3}]}`), &c3))
+	assert.EqualValues(420, c3.Files[0].Mode)
+	marshalled, err := json.Marshal(c)
+	assert.NoError(err)
+	var c4 tlc.Container
+	assert.NoError(json.Unmarshal(marshalled, &c4))
+	assert.True(proto.Equal(c, &c4))
+
+	t.Logf("Streaming")
+	dec := tlc.NewJSONDecoder(bytes.NewReader(buf.Bytes()))
+	var paths []string
+	for {
+		e, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(err)
+		if f, ok := e.(*tlc.File); ok && f.Path == "game.exe" {
+			assert.EqualValues(11, f.Offset)
+		}
+		paths = append(paths, e.GetPath())
+	}
+	assert.EqualValues([]string{"data", "data/level1.pak", "game.exe", "data/latest.pak", "data/copy.pak"}, paths)
+
+	// fields may come in any order, lists may be null or missing
+	c5, err := tlc.ReadJSON(strings.NewReader(`{"files":[{"path":"a","mode":"0644","size":3}],"dirs":null}`))
+	assert.NoError(err)
+	assert.EqualValues(3, c5.Size)
+
+	invalid := []string{
+		``,
+		`[]`,
+		`{"size":1}`,
+		`{"files":[{"path":"../a","mode":"0644","size":3}]}`,
+		`{"files":[{"path":"a","mode":"0644","size":3},{"path":"a","mode":"0644","size":3}]}`,
+		`{"files":[{"path":"a","mode":"rwx","size":3}]}`,
+		`{"files":[{"path":"a","mode":"0644","size":3}]`,
+		`{"dirs":[{"path":"a","mode":"0755"}],"colors":[]}`,
+		// not caught while streaming, but by validation
+		`{"files":[{"path":"a/b","mode":"0644","size":3}]}`,
+	}
+	for _, input := range invalid {
+		_, err := tlc.ReadJSON(strings.NewReader(input))
+		assert.Error(err, input)
+	}
+}
+
+func Test_YAML(t *testing.T) {
+	assert := assert.New(t)
+
+	c := exportTestContainer()
+
+	buf := new(bytes.Buffer)
+	assert.NoError(c.WriteYAML(buf))
+	s := buf.String()
+	assert.Contains(s, "mode: \"0755\"")
+	assert.Contains(s, "mtime: \"2020-03-01T15:04:05.123456789Z\"")
+	assert.Contains(s, "target: data/level1.pak")
+
+	c2, err := tlc.ReadYAML(bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+	assert.True(proto.Equal(c, c2), "yaml should round-trip")
+
+	_, err = tlc.ReadYAML(strings.NewReader("files:\n- path: ../a\n  mode: \"0644\"\n  size: 1\n"))
+	assert.Error(err)
+	_, err = tlc.ReadYAML(strings.NewReader("size: 2\nfiles:\n- path: a\n  mode: \"0644\"\n  size: 1\n"))
+	assert.Error(err)
+}
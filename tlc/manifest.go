@@ -0,0 +1,437 @@
+package tlc
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestHeader is the first line of every manifest
+const ManifestHeader = "# lake manifest v1"
+
+// WriteManifest writes a line-oriented, human-diffable description of the
+// container, meant to be checked into version control. Each entry takes
+// one line:
+//
+//	d 0755 - - some/dir
+//	f 0644 1024 sha256:e3b0c442... some/dir/file.dat
+//	l 0777 - - some/link -> file.dat
+//	h 0644 - - some/hardlink => some/dir/file.dat
+//
+// The fields are the entry type, its permissions (in octal, or the raw
+// mode in hexadecimal if it has unusual bits), its size and digest (for
+// files), its path, and its destination (for links). Paths that contain
+// special characters are quoted, Go-style.
+//
+// Metadata follows the entry it belongs to, on indented lines:
+//
+//	f 0644 1024 - file.dat
+//	  mtime 2020-03-01T15:04:05.123456789Z
+//	  owner 1000:1000
+//	  xattr user.comment "hello"
+//
+// Offsets and the container's size aren't written, they're derived from
+// file sizes when reading the manifest back, so only containers whose
+// offsets are consistent (see CheckConsistency) round-trip exactly.
+func (c *Container) WriteManifest(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	_, err := fmt.Fprintln(bw, ManifestHeader)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		err = writeManifestEntry(bw, e)
+		if err != nil {
+			return ForEachBreak
+		}
+		return ForEachContinue
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(bw.Flush())
+}
+
+func writeManifestEntry(w io.Writer, e Entry) error {
+	letter := manifestLetters[EntryTypeOf(e)]
+	size, digest := "-", "-"
+	var dest string
+
+	switch e := e.(type) {
+	case *File:
+		size = strconv.FormatInt(e.Size, 10)
+		if e.Digest != nil {
+			digest = e.Digest.ToString()
+		}
+	case *Symlink:
+		dest = " -> " + quoteManifestString(e.Dest)
+	case *Hardlink:
+		dest = " => " + quoteManifestString(e.Target)
+	}
+
+	_, err := fmt.Fprintf(w, "%c %s %s %s %s%s\n", letter, formatManifestMode(e), size, digest, quoteManifestString(e.GetPath()), dest)
+	if err != nil {
+		return err
+	}
+
+	if f, ok := e.(*File); ok && f.OriginalPath != "" {
+		_, err := fmt.Fprintf(w, "  original-path %s\n", quoteManifestString(f.OriginalPath))
+		if err != nil {
+			return err
+		}
+	}
+
+	m := e.GetMetadata()
+	if m == nil {
+		return nil
+	}
+	if m.Mtime != 0 {
+		_, err := fmt.Fprintf(w, "  mtime %s\n", time.Unix(0, m.Mtime).UTC().Format(time.RFC3339Nano))
+		if err != nil {
+			return err
+		}
+	}
+	if m.Owner != nil {
+		_, err := fmt.Fprintf(w, "  owner %d:%d\n", m.Owner.Uid, m.Owner.Gid)
+		if err != nil {
+			return err
+		}
+	}
+	for _, x := range m.Xattrs {
+		name := quoteManifestString(x.Name)
+		if name == x.Name && strings.Contains(name, " ") {
+			name = strconv.Quote(name)
+		}
+		_, err := fmt.Fprintf(w, "  xattr %s %s\n", name, strconv.Quote(string(x.Value)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var manifestLetters = map[EntryType]byte{
+	EntryTypeDir:      'd',
+	EntryTypeFile:     'f',
+	EntryTypeSymlink:  'l',
+	EntryTypeHardlink: 'h',
+}
+
+// manifestTypeBits are the mode type bits entries are expected to have
+func manifestTypeBits(t EntryType) os.FileMode {
+	switch t {
+	case EntryTypeDir:
+		return os.ModeDir
+	case EntryTypeSymlink:
+		return os.ModeSymlink
+	}
+	return 0
+}
+
+const unixSpecialBits = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+func formatManifestMode(e Entry) string {
+	mode := os.FileMode(e.GetMode())
+	if mode&^(os.ModePerm|unixSpecialBits) != manifestTypeBits(EntryTypeOf(e)) {
+		return fmt.Sprintf("0x%08x", uint32(mode))
+	}
+
+	perm := uint32(mode & os.ModePerm)
+	if mode&os.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	return fmt.Sprintf("%04o", perm)
+}
+
+func parseManifestMode(s string, t EntryType) (uint32, error) {
+	if strings.HasPrefix(s, "0x") {
+		mode, err := strconv.ParseUint(s[2:], 16, 32)
+		if err != nil {
+			return 0, errors.Errorf("invalid mode %q", s)
+		}
+		return uint32(mode), nil
+	}
+
+	perm, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || perm > 0o7777 {
+		return 0, errors.Errorf("invalid mode %q", s)
+	}
+
+	mode := manifestTypeBits(t) | os.FileMode(perm)&os.ModePerm
+	if perm&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if perm&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if perm&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return uint32(mode), nil
+}
+
+// quoteManifestString returns s as-is if it can be read back
+// unambiguously, and quoted otherwise
+func quoteManifestString(s string) string {
+	needsQuote := s == "" ||
+		s[0] == '"' ||
+		strings.HasPrefix(s, " ") ||
+		strings.HasSuffix(s, " ") ||
+		strings.Contains(s, " -> ") ||
+		strings.Contains(s, " => ") ||
+		!utf8.ValidString(s) ||
+		strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) && r != ' ' }) != -1
+	if needsQuote {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// readManifestString reads a possibly-quoted string at the start of s, and
+// returns it along with the rest of s. Unquoted strings end at the first
+// occurrence of sep, or at the end of s if sep is empty.
+func readManifestString(s string, sep string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				res, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return "", "", errors.Errorf("invalid quoted string %s", s[:i+1])
+				}
+				return res, s[i+1:], nil
+			}
+		}
+		return "", "", errors.Errorf("unterminated quoted string %s", s)
+	}
+
+	if sep != "" {
+		if i := strings.Index(s, sep); i != -1 {
+			return s[:i], s[i:], nil
+		}
+	}
+	return s, "", nil
+}
+
+// ReadManifest parses a manifest written by WriteManifest
+func ReadManifest(r io.Reader) (*Container, error) {
+	c := &Container{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var last Entry
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var err error
+		if strings.HasPrefix(line, "  ") {
+			if last == nil {
+				err = errors.New("metadata before any entry")
+			} else {
+				err = parseManifestMetadata(last, line[2:])
+			}
+		} else {
+			last, err = parseManifestEntry(c, line)
+		}
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("manifest line %d", lineNumber))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, f := range c.Files {
+		f.Offset = c.Size
+		c.Size += f.Size
+	}
+	return c, nil
+}
+
+func parseManifestEntry(c *Container, line string) (Entry, error) {
+	fields := strings.SplitN(line, " ", 5)
+	if len(fields) != 5 || len(fields[0]) != 1 {
+		return nil, errors.Errorf("invalid entry %q", line)
+	}
+
+	var entryType EntryType
+	for t, letter := range manifestLetters {
+		if fields[0][0] == letter {
+			entryType = t
+		}
+	}
+	if entryType == "" {
+		return nil, errors.Errorf("unknown entry type %q", fields[0])
+	}
+
+	mode, err := parseManifestMode(fields[1], entryType)
+	if err != nil {
+		return nil, err
+	}
+
+	var sep string
+	switch entryType {
+	case EntryTypeSymlink:
+		sep = " -> "
+	case EntryTypeHardlink:
+		sep = " => "
+	}
+
+	p, rest, err := readManifestString(fields[4], sep)
+	if err != nil {
+		return nil, err
+	}
+
+	var dest string
+	if sep != "" {
+		if !strings.HasPrefix(rest, sep) {
+			return nil, errors.Errorf("missing destination for %s", p)
+		}
+		dest, rest, err = readManifestString(rest[len(sep):], "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rest != "" {
+		return nil, errors.Errorf("trailing characters %q", rest)
+	}
+
+	if entryType != EntryTypeFile && (fields[2] != "-" || fields[3] != "-") {
+		return nil, errors.Errorf("only files have a size and a digest")
+	}
+
+	switch entryType {
+	case EntryTypeDir:
+		d := &Dir{Path: p, Mode: mode}
+		c.Dirs = append(c.Dirs, d)
+		return d, nil
+	case EntryTypeSymlink:
+		s := &Symlink{Path: p, Mode: mode, Dest: dest}
+		c.Symlinks = append(c.Symlinks, s)
+		return s, nil
+	case EntryTypeHardlink:
+		h := &Hardlink{Path: p, Mode: mode, Target: dest}
+		c.Hardlinks = append(c.Hardlinks, h)
+		return h, nil
+	}
+
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || size < 0 {
+		return nil, errors.Errorf("invalid size %q", fields[2])
+	}
+	f := &File{Path: p, Mode: mode, Size: size}
+	if fields[3] != "-" {
+		f.Digest, err = parseDigest(fields[3])
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.Files = append(c.Files, f)
+	return f, nil
+}
+
+// parseDigest parses the output of Digest.ToString
+func parseDigest(s string) (*Digest, error) {
+	i := strings.IndexByte(s, ':')
+	if i == -1 {
+		return nil, errors.Errorf("invalid digest %q", s)
+	}
+
+	algo, ok := HashAlgorithm_value[strings.ToUpper(s[:i])]
+	if !ok || HashAlgorithm(algo) == HashAlgorithm_NONE {
+		return nil, errors.Errorf("unknown hash algorithm %q", s[:i])
+	}
+
+	value, err := hex.DecodeString(s[i+1:])
+	if err != nil {
+		return nil, errors.Errorf("invalid digest %q", s)
+	}
+	return &Digest{Algorithm: HashAlgorithm(algo), Value: value}, nil
+}
+
+func parseManifestMetadata(e Entry, line string) error {
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) != 2 {
+		return errors.Errorf("invalid metadata %q", line)
+	}
+	key, value := fields[0], fields[1]
+
+	if key == "original-path" {
+		f, ok := e.(*File)
+		if !ok {
+			return errors.Errorf("only files have an original path")
+		}
+		p, rest, err := readManifestString(value, "")
+		if err != nil {
+			return err
+		}
+		if rest != "" {
+			return errors.Errorf("trailing characters %q", rest)
+		}
+		f.OriginalPath = p
+		return nil
+	}
+
+	m := e.GetMetadata()
+	if m == nil {
+		m = &Metadata{}
+		e.SetMetadata(m)
+	}
+
+	switch key {
+	case "mtime":
+		mtime, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return errors.Errorf("invalid mtime %q", value)
+		}
+		m.Mtime = mtime.UnixNano()
+	case "owner":
+		var uid, gid uint32
+		_, err := fmt.Sscanf(value, "%d:%d", &uid, &gid)
+		if err != nil {
+			return errors.Errorf("invalid owner %q", value)
+		}
+		m.Owner = &Ownership{Uid: uid, Gid: gid}
+	case "xattr":
+		name, rest, err := readManifestString(value, " ")
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(rest, " ") {
+			return errors.Errorf("missing value for xattr %s", name)
+		}
+		xvalue, err := strconv.Unquote(rest[1:])
+		if err != nil {
+			return errors.Errorf("invalid value for xattr %s", name)
+		}
+		m.Xattrs = append(m.Xattrs, &Xattr{Name: name, Value: []byte(xvalue)})
+	default:
+		return errors.Errorf("unknown metadata %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package tlc_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Manifest(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &tlc.Container{
+		Dirs: []*tlc.Dir{
+			{Path: "data", Mode: uint32(os.ModeDir | 0o755)},
+			{Path: "odd dir", Mode: uint32(os.ModeDir | os.ModeSetgid | 0o775)},
+		},
+		Files: []*tlc.File{
+			{
+				Path: "data/level 1.pak", Mode: 0o644, Size: 11,
+				Digest: &tlc.Digest{Algorithm: tlc.HashAlgorithm_SHA256, Value: []byte{0xde, 0xad, 0xbe, 0xef}},
+				Metadata: &tlc.Metadata{
+					Mtime:  1583075045123456789,
+					Owner:  &tlc.Ownership{Uid: 1000, Gid: 100},
+					Xattrs: []*tlc.Xattr{{Name: "user.with space", Value: []byte{0, 1, 2, 'a'}}},
+				},
+			},
+			{Path: "game.exe", Mode: 0o755 | uint32(os.ModeSetuid), Size: 5},
+			{Path: "caf\u00e9.txt", Mode: 0o644, Size: 0, OriginalPath: "cafe\u0301.txt"},
+			{Path: " tricky -> name\n", Mode: 0o600, Size: 1},
+			{Path: `"quoted"`, Mode: uint32(os.ModeDevice | 0o644), Size: 2},
+		},
+		Symlinks: []*tlc.Symlink{
+			{Path: "data/latest.pak", Mode: uint32(os.ModeSymlink | 0o777), Dest: "level 1.pak"},
+			{Path: "weird", Mode: uint32(os.ModeSymlink | 0o777), Dest: "x => y"},
+		},
+		Hardlinks: []*tlc.Hardlink{
+			{Path: "data/copy.pak", Mode: 0o644, Target: "data/level 1.pak"},
+		},
+	}
+	c.Normalize()
+
+	buf := new(bytes.Buffer)
+	assert.NoError(c.WriteManifest(buf))
+
+	lines := strings.Split(buf.String(), "\n")
+	assert.EqualValues(tlc.ManifestHeader, lines[0])
+	assert.Contains(lines, "d 0755 - - data")
+	assert.Contains(lines, "d 2775 - - odd dir")
+	assert.Contains(lines, "f 0644 11 sha256:deadbeef data/level 1.pak")
+	assert.Contains(lines, "  mtime 2020-03-01T15:04:05.123456789Z")
+	assert.Contains(lines, "  owner 1000:100")
+	assert.Contains(lines, `  xattr "user.with space" "\x00\x01\x02a"`)
+	assert.Contains(lines, "f 4755 5 - game.exe")
+	assert.Contains(lines, `f 0600 1 - " tricky -> name\n"`)
+	assert.Contains(lines, `f 0x040001a4 2 - "\"quoted\""`)
+	assert.Contains(lines, "l 0777 - - data/latest.pak -> level 1.pak")
+	assert.Contains(lines, `l 0777 - - weird -> "x => y"`)
+	assert.Contains(lines, "h 0644 - - data/copy.pak => data/level 1.pak")
+
+	c2, err := tlc.ReadManifest(bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+	assert.True(proto.Equal(c, c2), "manifest should round-trip")
+
+	// and be stable
+	buf2 := new(bytes.Buffer)
+	assert.NoError(c2.WriteManifest(buf2))
+	assert.EqualValues(buf.String(), buf2.String())
+
+	invalid := []string{
+		"x 0644 1 - foo",
+		"f 0999 1 - foo",
+		"f 0644 -1 - foo",
+		"f 0644 1 md5:abcd foo",
+		"d 0755 1 - foo",
+		"l 0777 - - foo",
+		`f 0644 1 - "unterminated`,
+		`f 0644 1 - "foo" bar`,
+		"  mtime 2020-03-01T15:04:05Z",
+		"f 0644 1 - foo\n  owner root",
+		"f 0644 1 - foo\n  color blue",
+	}
+	for _, manifest := range invalid {
+		_, err := tlc.ReadManifest(strings.NewReader(manifest))
+		assert.Error(err, manifest)
+	}
+}
@@ -0,0 +1,257 @@
+package tlc
+
+import (
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// ErrMergeConflict is returned (wrapped) by Merge when layers conflict
+// and the policy for that kind of conflict is MergeError.
+var ErrMergeConflict = errors.New("Merge conflict")
+
+// A MergePolicy decides what happens when two layers
+// have entries at the same path
+type MergePolicy int
+
+const (
+	// MergeError makes Merge fail
+	MergeError MergePolicy = iota
+	// MergeLastWins keeps the entry from the topmost layer
+	MergeLastWins
+	// MergeKeepFirst keeps the entry from the bottommost layer
+	MergeKeepFirst
+)
+
+type MergeOpts struct {
+	// Policy applies when two layers have a file, symlink or hardlink
+	// at the same path. Identical entries (same type, permissions,
+	// symlink destination or hardlink target, and file digest if both
+	// files have one) never conflict.
+	Policy MergePolicy
+
+	// TypeConflicts applies when a layer has a directory where another
+	// layer has a file, symlink or hardlink. When the directory loses, it's
+	// dropped along with everything in it.
+	TypeConflicts MergePolicy
+}
+
+// A FileSource tells where a file of a merged container comes from:
+// FileIndex is the index of the file in the container of layer Layer.
+type FileSource struct {
+	Layer     int
+	FileIndex int64
+}
+
+// A SourceMap gives the source of every file of a merged container, by index
+type SourceMap []FileSource
+
+// Merge layers containers on top of c, like DLCs or mods over a base game,
+// and returns the combined container. c is layer 0, and the others follow
+// in order. Directories from all layers are merged, other conflicts are
+// resolved according to opts.
+//
+// Entries are listed in the order they're first seen, and files are given
+// new offsets: the returned SourceMap tells which layer (and which file of
+// that layer) each file of the merged container comes from. Entries are
+// copies, the layers are not modified.
+func (c *Container) Merge(opts MergeOpts, layers ...*Container) (*Container, SourceMap, error) {
+	m := &merger{
+		opts:    opts,
+		entries: make(map[string]*mergeEntry),
+	}
+
+	all := append([]*Container{c}, layers...)
+	for layer, lc := range all {
+		var err error
+		add := func(e Entry, fileIndex int64) bool {
+			err = m.add(&mergeEntry{entry: e, layer: layer, fileIndex: fileIndex})
+			return err == nil
+		}
+
+		for _, d := range lc.Dirs {
+			if !add(d, -1) {
+				return nil, nil, err
+			}
+		}
+		for i, f := range lc.Files {
+			if !add(f, int64(i)) {
+				return nil, nil, err
+			}
+		}
+		for _, s := range lc.Symlinks {
+			if !add(s, -1) {
+				return nil, nil, err
+			}
+		}
+		for _, h := range lc.Hardlinks {
+			if !add(h, -1) {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return m.result()
+}
+
+type merger struct {
+	opts    MergeOpts
+	entries map[string]*mergeEntry
+	order   []string
+}
+
+type mergeEntry struct {
+	// nil for directories that no layer has an entry for
+	entry     Entry
+	layer     int
+	fileIndex int64
+}
+
+func (me *mergeEntry) isDir() bool {
+	_, ok := me.entry.(*Dir)
+	return me.entry == nil || ok
+}
+
+func (me *mergeEntry) entryType() EntryType {
+	if me.entry == nil {
+		return EntryTypeDir
+	}
+	return EntryTypeOf(me.entry)
+}
+
+func (m *merger) put(p string, me *mergeEntry) {
+	if _, ok := m.entries[p]; !ok {
+		m.order = append(m.order, p)
+	}
+	m.entries[p] = me
+}
+
+// remove removes the entry at p and everything in it
+func (m *merger) remove(p string) {
+	prefix := p + "/"
+	for q := range m.entries {
+		if q == p || strings.HasPrefix(q, prefix) {
+			delete(m.entries, q)
+		}
+	}
+}
+
+func conflict(existing *mergeEntry, me *mergeEntry, p string) error {
+	return errors.Wrapf(ErrMergeConflict, "%s %s (layer %d) conflicts with %s %s (layer %d)",
+		me.entryType(), me.entry.GetPath(), me.layer, existing.entryType(), p, existing.layer)
+}
+
+func (m *merger) add(me *mergeEntry) error {
+	p := me.entry.GetPath()
+
+	for _, parent := range parentPaths(p) {
+		existing, ok := m.entries[parent]
+		if !ok {
+			m.put(parent, &mergeEntry{layer: me.layer})
+			continue
+		}
+		if existing.isDir() {
+			continue
+		}
+
+		switch m.opts.TypeConflicts {
+		case MergeKeepFirst:
+			return nil
+		case MergeLastWins:
+			m.remove(parent)
+			m.put(parent, &mergeEntry{layer: me.layer})
+		default:
+			return conflict(existing, me, parent)
+		}
+	}
+
+	existing, ok := m.entries[p]
+	if !ok {
+		m.put(p, me)
+		return nil
+	}
+
+	switch {
+	case existing.isDir() && me.isDir():
+		if existing.entry == nil || m.opts.Policy == MergeLastWins {
+			m.put(p, me)
+		}
+	case existing.isDir() != me.isDir():
+		switch m.opts.TypeConflicts {
+		case MergeKeepFirst:
+		case MergeLastWins:
+			m.remove(p)
+			m.put(p, me)
+		default:
+			return conflict(existing, me, p)
+		}
+	case sameEntry(existing.entry, me.entry):
+		// not a conflict
+	default:
+		switch m.opts.Policy {
+		case MergeKeepFirst:
+		case MergeLastWins:
+			m.put(p, me)
+		default:
+			return conflict(existing, me, p)
+		}
+	}
+	return nil
+}
+
+// sameEntry returns true if two non-directory entries are known
+// to be identical
+func sameEntry(a Entry, b Entry) bool {
+	if EntryTypeOf(a) != EntryTypeOf(b) || a.GetMode() != b.GetMode() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *File:
+		b := b.(*File)
+		return a.Size == b.Size && a.Digest != nil && a.Digest.Equal(b.Digest)
+	case *Symlink:
+		return a.Dest == b.(*Symlink).Dest
+	case *Hardlink:
+		return a.Target == b.(*Hardlink).Target
+	}
+	return false
+}
+
+func (m *merger) result() (*Container, SourceMap, error) {
+	res := &Container{}
+	var sources SourceMap
+
+	emitted := make(map[string]bool)
+	for _, p := range m.order {
+		me, ok := m.entries[p]
+		if !ok || emitted[p] {
+			continue
+		}
+		emitted[p] = true
+
+		if me.entry == nil {
+			// parent directories stay implicit, like in the layers
+			continue
+		}
+
+		e := proto.Clone(me.entry.(proto.Message)).(Entry)
+		res.addEntry(e)
+		if _, ok := e.(*File); ok {
+			sources = append(sources, FileSource{Layer: me.layer, FileIndex: me.fileIndex})
+		}
+	}
+
+	for _, h := range res.Hardlinks {
+		target, ok := m.entries[h.Target]
+		if !ok {
+			return nil, nil, errors.Errorf("merged hardlink %s points to %s, which is not in the merged container", h.Path, h.Target)
+		}
+		if _, ok := target.entry.(*File); !ok {
+			return nil, nil, errors.Errorf("merged hardlink %s points to %s, which is a %s in the merged container", h.Path, h.Target, target.entryType())
+		}
+	}
+
+	return res, sources, nil
+}
@@ -0,0 +1,79 @@
+package tlc_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/itchio/lake/tlc"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Merge(t *testing.T) {
+	assert := assert.New(t)
+
+	base, err := tlc.NewBuilder().
+		File("game.exe", 0o755, 10).
+		File("data/base.pak", 0o644, 20).
+		File("data/shared.pak", 0o644, 30).
+		Symlink("data/latest", 0o777, "base.pak").
+		Build()
+	assert.NoError(err)
+
+	dlc, err := tlc.NewBuilder().
+		Dir("data", 0o700).
+		File("data/dlc.pak", 0o644, 5).
+		File("data/shared.pak", 0o644, 6).
+		Build()
+	assert.NoError(err)
+
+	_, _, err = base.Merge(tlc.MergeOpts{}, dlc)
+	assert.EqualValues(tlc.ErrMergeConflict, errors.Cause(err))
+
+	merged, sources, err := base.Merge(tlc.MergeOpts{Policy: tlc.MergeLastWins}, dlc)
+	assert.NoError(err)
+	assert.NoError(merged.Validate())
+	assert.Len(merged.Files, 4)
+	assert.EqualValues(10+20+6+5, merged.Size)
+	assert.EqualValues(os.ModeDir|0o700, os.FileMode(merged.Dirs[0].Mode))
+	assert.EqualValues(tlc.SourceMap{
+		{Layer: 0, FileIndex: 0},
+		{Layer: 0, FileIndex: 1},
+		{Layer: 1, FileIndex: 1},
+		{Layer: 1, FileIndex: 0},
+	}, sources)
+	// layers aren't modified
+	assert.EqualValues(60, base.Size)
+	assert.EqualValues(os.ModeDir|0o755, os.FileMode(base.Dirs[0].Mode))
+
+	merged, sources, err = base.Merge(tlc.MergeOpts{Policy: tlc.MergeKeepFirst}, dlc)
+	assert.NoError(err)
+	assert.EqualValues(os.ModeDir|0o755, os.FileMode(merged.Dirs[0].Mode))
+	assert.EqualValues(tlc.FileSource{Layer: 0, FileIndex: 2}, sources[2])
+
+	// file-vs-dir conflicts
+	mod, err := tlc.NewBuilder().
+		File("data", 0o644, 1).
+		Dir("game.exe/plugins", 0o755).
+		Build()
+	assert.NoError(err)
+
+	_, _, err = base.Merge(tlc.MergeOpts{Policy: tlc.MergeLastWins}, mod)
+	assert.EqualValues(tlc.ErrMergeConflict, errors.Cause(err))
+
+	merged, sources, err = base.Merge(tlc.MergeOpts{TypeConflicts: tlc.MergeLastWins}, mod)
+	assert.NoError(err)
+	assert.NoError(merged.Validate())
+	var paths []string
+	merged.ForEachEntry(func(e tlc.Entry) tlc.ForEachOutcome {
+		paths = append(paths, e.GetPath())
+		return tlc.ForEachContinue
+	})
+	assert.EqualValues([]string{"game.exe", "game.exe/plugins", "data"}, paths)
+	assert.EqualValues(tlc.SourceMap{{Layer: 1, FileIndex: 0}}, sources)
+
+	merged, _, err = base.Merge(tlc.MergeOpts{TypeConflicts: tlc.MergeKeepFirst}, mod)
+	assert.NoError(err)
+	assert.True(proto.Equal(base, merged))
+}
@@ -0,0 +1,179 @@
+package tlc
+
+import (
+	"encoding/binary"
+	"os"
+	"time"
+
+	"github.com/itchio/arkive/zip"
+	"github.com/pkg/errors"
+)
+
+// MetadataOpts selects which extended metadata gets captured when
+// walking, and restored when preparing or writing to disk. By default,
+// none of it is.
+type MetadataOpts struct {
+	// Mtimes are modification times
+	Mtimes bool
+
+	// Ownership is the numeric user and group IDs. Restoring it
+	// usually requires elevated privileges.
+	Ownership bool
+
+	// Xattrs are extended attributes, which are only supported on
+	// Linux and macOS, and never stored in zip archives.
+	Xattrs bool
+}
+
+func (opts MetadataOpts) any() bool {
+	return opts.Mtimes || opts.Ownership || opts.Xattrs
+}
+
+// ModTime returns the modification time, and false if it's unknown
+func (m *Metadata) ModTime() (time.Time, bool) {
+	if m == nil || m.Mtime == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, m.Mtime), true
+}
+
+// capture returns the metadata of the file at fullPath selected by opts,
+// or nil if none was. Symlinks are only followed if follow is true.
+func (opts MetadataOpts) capture(fullPath string, fileInfo os.FileInfo, follow bool) (*Metadata, error) {
+	if !opts.any() {
+		return nil, nil
+	}
+
+	m := &Metadata{}
+	if opts.Mtimes {
+		m.Mtime = fileInfo.ModTime().UnixNano()
+	}
+	if opts.Ownership {
+		m.Owner = ownerOf(fileInfo)
+	}
+	if opts.Xattrs {
+		xattrs, err := readXattrs(fullPath, follow)
+		if err != nil {
+			return nil, errors.WithMessage(err, "while reading extended attributes")
+		}
+		m.Xattrs = xattrs
+	}
+
+	if m.Mtime == 0 && m.Owner == nil && len(m.Xattrs) == 0 {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// captureZip returns the metadata of a zip entry selected by opts,
+// or nil if none was
+func (opts MetadataOpts) captureZip(fh *zip.FileHeader) *Metadata {
+	m := &Metadata{}
+	if opts.Mtimes && !fh.Modified.IsZero() {
+		m.Mtime = fh.Modified.UnixNano()
+	}
+	if opts.Ownership {
+		m.Owner = parseZipOwnership(fh.Extra)
+	}
+
+	if m.Mtime == 0 && m.Owner == nil {
+		return nil
+	}
+	return m
+}
+
+// ApplyMetadata restores the metadata selected by opts on the entry at
+// fullPath, which is never followed if it's a symlink. The modification
+// time is set last, since setting the others may change it.
+func ApplyMetadata(fullPath string, m *Metadata, opts MetadataOpts) error {
+	if m == nil {
+		return nil
+	}
+
+	if opts.Ownership && m.Owner != nil {
+		err := setOwner(fullPath, m.Owner)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if opts.Xattrs && len(m.Xattrs) > 0 {
+		err := writeXattrs(fullPath, m.Xattrs)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if mtime, ok := m.ModTime(); ok && opts.Mtimes {
+		err := setMtime(fullPath, mtime)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// zipUnixExtraID is the "Info-ZIP New Unix" extra field, which
+// stores user and group IDs
+const zipUnixExtraID = 0x7875
+
+// ZipOwnershipExtra returns a zip extra field storing the given ownership
+func ZipOwnershipExtra(o *Ownership) []byte {
+	buf := make([]byte, 4+1+1+4+1+4)
+	binary.LittleEndian.PutUint16(buf[0:], zipUnixExtraID)
+	binary.LittleEndian.PutUint16(buf[2:], uint16(len(buf)-4))
+	buf[4] = 1 // version
+	buf[5] = 4
+	binary.LittleEndian.PutUint32(buf[6:], o.Uid)
+	buf[10] = 4
+	binary.LittleEndian.PutUint32(buf[11:], o.Gid)
+	return buf
+}
+
+// parseZipOwnership looks for ownership in zip extra fields,
+// and returns nil if there isn't any
+func parseZipOwnership(extra []byte) *Ownership {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:])
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return nil
+		}
+		field := extra[4 : 4+size]
+		extra = extra[4+size:]
+
+		if id != zipUnixExtraID || len(field) < 1 || field[0] != 1 {
+			continue
+		}
+		field = field[1:]
+
+		var ids []uint32
+		for i := 0; i < 2; i++ {
+			if len(field) < 1 || len(field) < 1+int(field[0]) {
+				return nil
+			}
+			n := int(field[0])
+			var id uint64
+			for j := n - 1; j >= 0; j-- {
+				id = id<<8 | uint64(field[1+j])
+			}
+			ids = append(ids, uint32(id))
+			field = field[1+n:]
+		}
+		return &Ownership{Uid: ids[0], Gid: ids[1]}
+	}
+	return nil
+}
+
+// HasHardlinks returns true if the file is known to have more than one link
+func HasHardlinks(fileInfo os.FileInfo) bool {
+	_, ok := hardlinkID(fileInfo)
+	return ok
+}
+
+// fileID uniquely identifies a file on a system, see WalkOpts.DetectHardlinks
+type fileID struct {
+	dev uint64
+	ino uint64
+}
@@ -0,0 +1,45 @@
+package tlc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func Test_Xattrs(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_xattrs")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpPath)
+
+	src := filepath.Join(tmpPath, "src")
+	must(t, os.MkdirAll(src, 0o755))
+	srcFile := filepath.Join(src, "a.txt")
+	must(t, ioutil.WriteFile(srcFile, []byte("hello"), 0o644))
+
+	err = unix.Setxattr(srcFile, "user.lake.test", []byte("some value"), 0)
+	if err == unix.ENOTSUP {
+		t.Skip("extended attributes are not supported here")
+	}
+	must(t, err)
+
+	opts := MetadataOpts{Xattrs: true}
+	c, err := WalkDir(src, WalkOpts{Metadata: opts})
+	must(t, err)
+	assert.EqualValues([]*Xattr{
+		{Name: "user.lake.test", Value: []byte("some value")},
+	}, c.Files[0].Metadata.GetXattrs())
+
+	dst := filepath.Join(tmpPath, "dst")
+	must(t, c.PrepareWithOpts(dst, PrepareOpts{Metadata: opts}))
+
+	value := make([]byte, 64)
+	n, err := unix.Getxattr(filepath.Join(dst, "a.txt"), "user.lake.test", value)
+	must(t, err)
+	assert.EqualValues("some value", string(value[:n]))
+}
@@ -0,0 +1,44 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package tlc
+
+import (
+	"os"
+	"time"
+)
+
+// ownership, extended attributes and hardlinks are not supported
+// on this platform, they're neither captured nor restored
+
+func ownerOf(fileInfo os.FileInfo) *Ownership {
+	return nil
+}
+
+func hardlinkID(fileInfo os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+func setOwner(fullPath string, o *Ownership) error {
+	return nil
+}
+
+func setMtime(fullPath string, mtime time.Time) error {
+	stats, err := os.Lstat(fullPath)
+	if err != nil {
+		return err
+	}
+	if stats.Mode()&os.ModeSymlink != 0 {
+		// can't set the mtime of symlinks without following them
+		return nil
+	}
+	return os.Chtimes(fullPath, mtime, mtime)
+}
+
+func readXattrs(fullPath string, follow bool) ([]*Xattr, error) {
+	return nil, nil
+}
+
+func writeXattrs(fullPath string, xattrs []*Xattr) error {
+	return nil
+}
@@ -0,0 +1,139 @@
+package tlc_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/itchio/arkive/zip"
+	"github.com/itchio/lake/pools/fspool"
+	"github.com/itchio/lake/pools/zipwriterpool"
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MetadataRoundtrip(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_metadata")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpPath)
+
+	src := filepath.Join(tmpPath, "src")
+	assert.NoError(os.MkdirAll(filepath.Join(src, "sub"), 0o755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("hello"), 0o644))
+
+	mtime := time.Date(2015, time.March, 14, 9, 26, 53, 0, time.UTC)
+	assert.NoError(os.Chtimes(filepath.Join(src, "sub", "a.txt"), mtime, mtime))
+	assert.NoError(os.Chtimes(filepath.Join(src, "sub"), mtime.Add(time.Hour), mtime.Add(time.Hour)))
+
+	// not captured by default
+	c, err := tlc.WalkDir(src, tlc.WalkOpts{})
+	assert.NoError(err)
+	assert.Nil(c.Files[0].Metadata)
+
+	opts := tlc.MetadataOpts{Mtimes: true, Ownership: true}
+	c, err = tlc.WalkDir(src, tlc.WalkOpts{Metadata: opts})
+	assert.NoError(err)
+	fileTime, ok := c.Files[0].Metadata.ModTime()
+	assert.True(ok)
+	assert.True(mtime.Equal(fileTime))
+	dirTime, ok := c.Dirs[0].Metadata.ModTime()
+	assert.True(ok)
+	assert.True(mtime.Add(time.Hour).Equal(dirTime))
+
+	owner := c.Files[0].Metadata.GetOwner()
+	if owner != nil {
+		assert.EqualValues(os.Getuid(), owner.Uid)
+		assert.EqualValues(os.Getgid(), owner.Gid)
+	}
+
+	t.Logf("Restoring to disk")
+	dst := filepath.Join(tmpPath, "dst")
+	restoreOpts := tlc.MetadataOpts{Mtimes: true}
+	assert.NoError(c.PrepareWithOpts(dst, tlc.PrepareOpts{Metadata: restoreOpts}))
+	pool := fspool.New(c, dst)
+	pool.Metadata = restoreOpts
+	w, err := pool.GetWriter(0)
+	assert.NoError(err)
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(err)
+	assert.NoError(w.Close())
+
+	stats, err := os.Stat(filepath.Join(dst, "sub", "a.txt"))
+	assert.NoError(err)
+	assert.True(mtime.Equal(stats.ModTime()))
+	stats, err = os.Stat(filepath.Join(dst, "sub"))
+	assert.NoError(err)
+	assert.True(mtime.Add(time.Hour).Equal(stats.ModTime()))
+
+	t.Logf("Round-tripping through a zip")
+	c.Files[0].Metadata.Owner = &tlc.Ownership{Uid: 1234, Gid: 70000}
+	buf := new(bytes.Buffer)
+	zwp, err := zipwriterpool.New(c, zip.NewWriter(buf))
+	assert.NoError(err)
+	w, err = zwp.GetWriter(0)
+	assert.NoError(err)
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(err)
+	assert.NoError(w.Close())
+	assert.NoError(zwp.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(err)
+	zc, err := tlc.WalkZip(zr, tlc.WalkOpts{Metadata: opts})
+	assert.NoError(err)
+	assert.Len(zc.Files, 1)
+	zipTime, ok := zc.Files[0].Metadata.ModTime()
+	assert.True(ok)
+	assert.True(mtime.Equal(zipTime))
+	assert.EqualValues(&tlc.Ownership{Uid: 1234, Gid: 70000}, zc.Files[0].Metadata.Owner)
+
+	zc, err = tlc.WalkZip(zr, tlc.WalkOpts{})
+	assert.NoError(err)
+	assert.Nil(zc.Files[0].Metadata)
+}
+
+func Test_MetadataNanosecondMtimes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("NTFS only stores mtimes with a 100ns precision")
+	}
+
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_metadata_ns")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpPath)
+
+	src := filepath.Join(tmpPath, "src")
+	assert.NoError(os.MkdirAll(src, 0o755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("hello"), 0o644))
+
+	mtime := time.Date(2015, time.March, 14, 9, 26, 53, 589793238, time.UTC)
+	assert.NoError(os.Chtimes(filepath.Join(src, "a.txt"), mtime, mtime))
+
+	opts := tlc.MetadataOpts{Mtimes: true}
+	c, err := tlc.WalkDir(src, tlc.WalkOpts{Metadata: opts})
+	assert.NoError(err)
+	fileTime, ok := c.Files[0].Metadata.ModTime()
+	assert.True(ok)
+	assert.EqualValues(mtime.UnixNano(), fileTime.UnixNano())
+
+	dst := filepath.Join(tmpPath, "dst")
+	assert.NoError(c.PrepareWithOpts(dst, tlc.PrepareOpts{Metadata: opts}))
+	pool := fspool.New(c, dst)
+	pool.Metadata = opts
+	w, err := pool.GetWriter(0)
+	assert.NoError(err)
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(err)
+	assert.NoError(w.Close())
+
+	stats, err := os.Stat(filepath.Join(dst, "a.txt"))
+	assert.NoError(err)
+	assert.EqualValues(mtime.UnixNano(), stats.ModTime().UnixNano())
+}
@@ -0,0 +1,104 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package tlc
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+func ownerOf(fileInfo os.FileInfo) *Ownership {
+	st, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return &Ownership{Uid: st.Uid, Gid: st.Gid}
+}
+
+// hardlinkID returns the device and inode of a file,
+// if it has more than one link
+func hardlinkID(fileInfo os.FileInfo) (fileID, bool) {
+	st, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink <= 1 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+func setOwner(fullPath string, o *Ownership) error {
+	return os.Lchown(fullPath, int(o.Uid), int(o.Gid))
+}
+
+func setMtime(fullPath string, mtime time.Time) error {
+	// timevals only have microseconds, timespecs keep the full precision
+	ts := unix.NsecToTimespec(mtime.UnixNano())
+	return unix.UtimesNanoAt(unix.AT_FDCWD, fullPath, []unix.Timespec{ts, ts}, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+func isXattrUnsupported(err error) bool {
+	return err == unix.ENOTSUP || err == unix.EOPNOTSUPP
+}
+
+func readXattrs(fullPath string, follow bool) ([]*Xattr, error) {
+	list, get := unix.Llistxattr, unix.Lgetxattr
+	if follow {
+		list, get = unix.Listxattr, unix.Getxattr
+	}
+
+	size, err := list(fullPath, nil)
+	if err != nil {
+		if isXattrUnsupported(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+	size, err = list(fullPath, buf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	sort.Strings(names)
+
+	var xattrs []*Xattr
+	for _, name := range names {
+		size, err := get(fullPath, name, nil)
+		if err != nil {
+			return nil, errors.WithMessage(err, name)
+		}
+		value := make([]byte, size)
+		size, err = get(fullPath, name, value)
+		if err != nil {
+			return nil, errors.WithMessage(err, name)
+		}
+		xattrs = append(xattrs, &Xattr{Name: name, Value: value[:size]})
+	}
+	return xattrs, nil
+}
+
+func writeXattrs(fullPath string, xattrs []*Xattr) error {
+	for _, x := range xattrs {
+		err := unix.Lsetxattr(fullPath, x.Name, x.Value, 0)
+		if err != nil {
+			return errors.WithMessage(err, x.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package tlc
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The methods below edit a container while keeping it consistent: file
+// offsets and the container's size are kept up-to-date, missing parent
+// directories are added, and paths are validated before anything changes.
+//
+// New entries are appended, so existing file indices stay valid, except
+// after Remove and Move.
+
+// AddDir adds a directory to the container
+func (c *Container) AddDir(p string, perm os.FileMode) (*Dir, error) {
+	d := &Dir{Path: p, Mode: uint32(os.ModeDir | perm&^os.ModeType)}
+	err := c.insert(d, c.lookupEntry, nil)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// AddFile adds a file to the container, after all other files
+func (c *Container) AddFile(p string, perm os.FileMode, size int64) (*File, error) {
+	f := &File{Path: p, Mode: uint32(perm &^ os.ModeType), Size: size}
+	err := c.insert(f, c.lookupEntry, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// AddSymlink adds a symlink to the container
+func (c *Container) AddSymlink(p string, perm os.FileMode, dest string) (*Symlink, error) {
+	s := &Symlink{Path: p, Mode: uint32(os.ModeSymlink | perm&^os.ModeType), Dest: dest}
+	err := c.insert(s, c.lookupEntry, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AddHardlink adds a hardlink to the container. Its target must be a file
+// that's already in the container.
+func (c *Container) AddHardlink(p string, target string) (*Hardlink, error) {
+	h := &Hardlink{Path: p, Target: target}
+	err := c.insert(h, c.lookupEntry, nil)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// lookupEntry returns the entry at p, or nil if there's none
+func (c *Container) lookupEntry(p string) Entry {
+	var res Entry
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		if e.GetPath() == p {
+			res = e
+			return ForEachBreak
+		}
+		return ForEachContinue
+	})
+	return res
+}
+
+// insert validates e and adds it, along with missing parent directories.
+// added, if non-nil, is called for every new entry.
+func (c *Container) insert(e Entry, lookup func(p string) Entry, added func(e Entry)) error {
+	p := e.GetPath()
+	err := ValidatePath(p)
+	if err != nil {
+		return err
+	}
+
+	if existing := lookup(p); existing != nil {
+		return errors.Errorf("can't add %s %s: there's already a %s there", EntryTypeOf(e), p, EntryTypeOf(existing))
+	}
+
+	switch e := e.(type) {
+	case *File:
+		if e.Size < 0 {
+			return errors.Errorf("can't add file %s: negative size %d", p, e.Size)
+		}
+	case *Hardlink:
+		err := ValidatePath(e.Target)
+		if err != nil {
+			return errors.WithMessage(err, "invalid hardlink target")
+		}
+		target, ok := lookup(e.Target).(*File)
+		if !ok {
+			return errors.Errorf("can't add hardlink %s: target %s is not a file in the container", p, e.Target)
+		}
+		e.Mode = target.Mode
+	}
+
+	var missing []string
+	for _, parent := range parentPaths(p) {
+		existing := lookup(parent)
+		if existing == nil {
+			missing = append(missing, parent)
+			continue
+		}
+		if _, ok := existing.(*Dir); !ok {
+			return errors.Errorf("can't add %s: %s is a %s", p, parent, EntryTypeOf(existing))
+		}
+	}
+
+	for _, parent := range missing {
+		d := &Dir{Path: parent, Mode: uint32(0o755 | os.ModeDir)}
+		c.addEntry(d)
+		if added != nil {
+			added(d)
+		}
+	}
+	c.addEntry(e)
+	if added != nil {
+		added(e)
+	}
+	return nil
+}
+
+// Remove removes the entry at p from the container. If p is a directory,
+// everything in it is removed as well. Files can't be removed while
+// hardlinks that aren't removed along with them point to them.
+//
+// Since offsets are recomputed, pools built for the container before
+// must not be used afterwards.
+func (c *Container) Remove(p string) error {
+	if !c.hasPath(p) {
+		return errors.Errorf("can't remove %s: no such entry", p)
+	}
+
+	inSubtree := func(q string) bool {
+		return q == p || strings.HasPrefix(q, p+"/")
+	}
+
+	for _, h := range c.Hardlinks {
+		if inSubtree(h.Target) && !inSubtree(h.Path) {
+			return errors.Errorf("can't remove %s: hardlink %s points to %s", p, h.Path, h.Target)
+		}
+	}
+
+	var dirs []*Dir
+	for _, d := range c.Dirs {
+		if !inSubtree(d.Path) {
+			dirs = append(dirs, d)
+		}
+	}
+	var files []*File
+	for _, f := range c.Files {
+		if !inSubtree(f.Path) {
+			files = append(files, f)
+		}
+	}
+	var symlinks []*Symlink
+	for _, s := range c.Symlinks {
+		if !inSubtree(s.Path) {
+			symlinks = append(symlinks, s)
+		}
+	}
+	var hardlinks []*Hardlink
+	for _, h := range c.Hardlinks {
+		if !inSubtree(h.Path) {
+			hardlinks = append(hardlinks, h)
+		}
+	}
+
+	c.Dirs = dirs
+	c.Files = files
+	c.Symlinks = symlinks
+	c.Hardlinks = hardlinks
+	c.fixOffsets()
+	return nil
+}
+
+// Move moves (or renames) the entry at oldPath to newPath, along with
+// everything in it if it's a directory. Missing parent directories of
+// newPath are added, and hardlinks to moved files are retargeted.
+// Symlink destinations are left as-is, even if they're relative.
+func (c *Container) Move(oldPath string, newPath string) error {
+	err := ValidatePath(newPath)
+	if err != nil {
+		return err
+	}
+	if !c.hasPath(oldPath) {
+		return errors.Errorf("can't move %s: no such entry", oldPath)
+	}
+	if c.hasPath(newPath) {
+		return errors.Errorf("can't move %s to %s: destination already exists", oldPath, newPath)
+	}
+	if strings.HasPrefix(newPath, oldPath+"/") {
+		return errors.Errorf("can't move %s into itself", oldPath)
+	}
+
+	var missing []string
+	for _, parent := range parentPaths(newPath) {
+		existing := c.lookupEntry(parent)
+		if existing == nil {
+			if !c.hasPath(parent) {
+				missing = append(missing, parent)
+			}
+			continue
+		}
+		if _, ok := existing.(*Dir); !ok {
+			return errors.Errorf("can't move %s to %s: %s is a %s", oldPath, newPath, parent, EntryTypeOf(existing))
+		}
+	}
+
+	rewrite := func(p string) string {
+		if p == oldPath {
+			return newPath
+		}
+		if strings.HasPrefix(p, oldPath+"/") {
+			return newPath + p[len(oldPath):]
+		}
+		return p
+	}
+
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		e.SetPath(rewrite(e.GetPath()))
+		if h, ok := e.(*Hardlink); ok {
+			h.Target = rewrite(h.Target)
+		}
+		return ForEachContinue
+	})
+
+	// copy the lists, so that indexes of the container notice the change
+	c.Dirs = append([]*Dir(nil), c.Dirs...)
+	c.Files = append([]*File(nil), c.Files...)
+	c.Symlinks = append([]*Symlink(nil), c.Symlinks...)
+	c.Hardlinks = append([]*Hardlink(nil), c.Hardlinks...)
+
+	for _, parent := range missing {
+		c.addEntry(&Dir{Path: parent, Mode: uint32(0o755 | os.ModeDir)})
+	}
+	return nil
+}
+
+// Chmod changes the permissions of the entry at p. The entry's type
+// bits are kept, and hardlinks to a file follow its permissions.
+func (c *Container) Chmod(p string, perm os.FileMode) error {
+	e := c.lookupEntry(p)
+	if e == nil {
+		return errors.Errorf("can't chmod %s: no such entry", p)
+	}
+	if h, ok := e.(*Hardlink); ok {
+		return errors.Errorf("can't chmod hardlink %s, chmod its target %s instead", p, h.Target)
+	}
+
+	mode := os.FileMode(e.GetMode())&os.ModeType | perm&^os.ModeType
+	e.SetMode(uint32(mode))
+	if _, ok := e.(*File); ok {
+		for _, h := range c.Hardlinks {
+			if h.Target == p {
+				h.Mode = uint32(mode)
+			}
+		}
+	}
+	return nil
+}
+
+// hasPath returns true if p is an entry of the container, or
+// a directory that contains some
+func (c *Container) hasPath(p string) bool {
+	found := false
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		ep := e.GetPath()
+		if ep == p || strings.HasPrefix(ep, p+"/") {
+			found = true
+			return ForEachBreak
+		}
+		return ForEachContinue
+	})
+	return found
+}
+
+func (c *Container) fixOffsets() {
+	offset := int64(0)
+	for _, f := range c.Files {
+		f.Offset = offset
+		offset += f.Size
+	}
+	c.Size = offset
+}
+
+// A Builder creates a container entry by entry, see AddDir, AddFile,
+// AddSymlink and AddHardlink. Errors are sticky: once a call fails,
+// the following ones do nothing, and Build returns the error.
+type Builder struct {
+	c       *Container
+	entries map[string]Entry
+	err     error
+}
+
+// NewBuilder returns a builder for an empty container
+func NewBuilder() *Builder {
+	return &Builder{
+		c:       &Container{},
+		entries: make(map[string]Entry),
+	}
+}
+
+func (b *Builder) add(e Entry) *Builder {
+	if b.err != nil {
+		return b
+	}
+	b.err = b.c.insert(e, b.lookup, b.added)
+	return b
+}
+
+func (b *Builder) lookup(p string) Entry {
+	return b.entries[p]
+}
+
+func (b *Builder) added(e Entry) {
+	b.entries[e.GetPath()] = e
+}
+
+// Dir adds a directory
+func (b *Builder) Dir(p string, perm os.FileMode) *Builder {
+	return b.add(&Dir{Path: p, Mode: uint32(os.ModeDir | perm&^os.ModeType)})
+}
+
+// File adds a file
+func (b *Builder) File(p string, perm os.FileMode, size int64) *Builder {
+	return b.add(&File{Path: p, Mode: uint32(perm &^ os.ModeType), Size: size})
+}
+
+// Symlink adds a symlink
+func (b *Builder) Symlink(p string, perm os.FileMode, dest string) *Builder {
+	return b.add(&Symlink{Path: p, Mode: uint32(os.ModeSymlink | perm&^os.ModeType), Dest: dest})
+}
+
+// Hardlink adds a hardlink to a file that was added before
+func (b *Builder) Hardlink(p string, target string) *Builder {
+	return b.add(&Hardlink{Path: p, Target: target})
+}
+
+// Build returns the container, or the first error encountered
+// while building it
+func (b *Builder) Build() (*Container, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.c, nil
+}
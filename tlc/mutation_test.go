@@ -0,0 +1,84 @@
+package tlc_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Builder(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := tlc.NewBuilder().
+		File("bin/game", 0o755, 10).
+		File("data/a.pak", 0o644, 20).
+		Symlink("bin/latest", 0o777, "game").
+		Hardlink("data/b.pak", "data/a.pak").
+		Dir("saves", 0o700).
+		Build()
+	assert.NoError(err)
+	assert.NoError(c.Validate())
+	assert.EqualValues(30, c.Size)
+	assert.EqualValues(10, c.Files[1].Offset)
+	assert.EqualValues([]string{"bin", "data", "saves"}, []string{c.Dirs[0].Path, c.Dirs[1].Path, c.Dirs[2].Path})
+	assert.EqualValues(os.ModeSymlink|0o777, os.FileMode(c.Symlinks[0].Mode))
+
+	_, err = tlc.NewBuilder().File("a", 0o644, 1).File("a/b", 0o644, 1).Dir("c", 0o755).Build()
+	assert.Error(err)
+	_, err = tlc.NewBuilder().File("a", 0o644, 1).File("a", 0o644, 1).Build()
+	assert.Error(err)
+	_, err = tlc.NewBuilder().File("../a", 0o644, 1).Build()
+	assert.Error(err)
+	_, err = tlc.NewBuilder().Hardlink("a", "b").Build()
+	assert.Error(err)
+}
+
+func Test_Mutation(t *testing.T) {
+	assert := assert.New(t)
+
+	c := exportTestContainer()
+	idx := tlc.NewIndex(c)
+
+	f, err := c.AddFile("mods/extra/mod.pak", 0o644, 7)
+	assert.NoError(err)
+	assert.EqualValues(16, f.Offset)
+	assert.EqualValues(23, c.Size)
+	assert.True(idx.Exists("mods/extra"))
+	assert.NotNil(idx.Lookup("mods"))
+
+	_, err = c.AddDir("game.exe/foo", 0o755)
+	assert.Error(err)
+	_, err = c.AddSymlink("data/latest.pak", 0o777, "nope")
+	assert.Error(err)
+
+	// hardlinks keep their target alive
+	assert.Error(c.Remove("data/level1.pak"))
+
+	assert.NoError(c.Move("data", "content"))
+	assert.NoError(c.Validate())
+	assert.True(idx.Exists("content/level1.pak"))
+	assert.False(idx.Exists("data"))
+	assert.EqualValues("content/level1.pak", c.Hardlinks[0].Target)
+
+	assert.Error(c.Move("content", "content/inner"))
+	assert.Error(c.Move("content", "game.exe"))
+	assert.Error(c.Move("nope", "other"))
+
+	assert.NoError(c.Move("game.exe", "bin/game.exe"))
+	assert.NotNil(idx.Lookup("bin"))
+
+	assert.NoError(c.Chmod("content/level1.pak", 0o600))
+	assert.EqualValues(0o600, c.Hardlinks[0].Mode)
+	assert.NoError(c.Chmod("content", 0o700))
+	assert.EqualValues(os.ModeDir|0o700, os.FileMode(idx.Lookup("content").GetMode()))
+	assert.Error(c.Chmod("content/copy.pak", 0o644))
+
+	assert.NoError(c.Remove("content"))
+	assert.NoError(c.Validate())
+	assert.EqualValues(12, c.Size)
+	assert.EqualValues(0, idx.Size("content"))
+	assert.EqualValues(12, idx.Size(""))
+	assert.EqualValues(5, c.Files[1].Offset)
+}
@@ -0,0 +1,70 @@
+package tlc
+
+import (
+	"fmt"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldCase applies full Unicode case folding, so that
+// for example "STRASSE" and "straße" compare equal
+func foldCase(s string) string {
+	return cases.Fold().String(s)
+}
+
+// caselessKey returns a key that is the same for paths that are
+// canonically equivalent, ignoring case, like macOS filesystems do.
+func caselessKey(s string) string {
+	return norm.NFC.String(foldCase(norm.NFD.String(s)))
+}
+
+// NormalizePath returns the NFC form of a container path, which
+// is what most filesystems outside of macOS expect.
+func NormalizePath(p string) string {
+	return norm.NFC.String(p)
+}
+
+// AssertNormalizationSafe returns an error if there exists
+// multiple entries that differ only by their Unicode normalization
+// form, like `café` spelled with a precomposed "é" (NFC) and with
+// an "e" followed by a combining acute accent (NFD).
+//
+// It also catches entries that differ both by normalization and by case,
+// since those conflict on macOS.
+func (c *Container) AssertNormalizationSafe() error {
+	report := c.Report((*Container).CheckNormalizationConflicts)
+	return issuesError("Container is not normalization safe, found the following problems:", report.Issues)
+}
+
+// CheckNormalizationConflicts reports entries that only differ by their
+// Unicode normalization form (see AssertNormalizationSafe).
+func (c *Container) CheckNormalizationConflicts(report *ValidationReport) {
+	entries := make(map[string]Entry)
+
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		key := caselessKey(e.GetPath())
+		if other, ok := entries[key]; ok {
+			otherPath := other.GetPath()
+			// exact duplicates are caught by CheckDuplicates, and conflicts that
+			// case folding alone explains by CheckCaseConflicts
+			if otherPath != e.GetPath() && foldCase(otherPath) != foldCase(e.GetPath()) {
+				report.Add(SeverityError, IssueNormalizationConflict,
+					fmt.Sprintf("Normalization conflict between (%+q) and (%+q)", otherPath, e.GetPath()),
+					other, e)
+			}
+			return ForEachContinue
+		}
+		entries[key] = e
+		return ForEachContinue
+	})
+}
+
+// SourcePath returns the path the file was found at when walking,
+// which differs from Path if it was normalized (see WalkOpts.NormalizeUnicode).
+func (f *File) SourcePath() string {
+	if f.OriginalPath != "" {
+		return f.OriginalPath
+	}
+	return f.Path
+}
@@ -0,0 +1,62 @@
+package tlc_test
+
+import (
+	"testing"
+
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	cafeNFC = "caf\u00e9"
+	cafeNFD = "cafe\u0301"
+)
+
+func Test_AssertNormalizationSafe(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &tlc.Container{
+		Files: []*tlc.File{
+			&tlc.File{Path: "menu/" + cafeNFC},
+			&tlc.File{Path: "menu/" + cafeNFD},
+		},
+	}
+	err := c.AssertNormalizationSafe()
+	assert.Error(err)
+	t.Logf("As expected:\n%s", err)
+	assert.NoError(c.AssertCaseInsensitiveSafe(), "should not be a case conflict")
+
+	c.Files[1].Path = "MENU/CAFE\u0301"
+	assert.Error(c.AssertNormalizationSafe(), "should catch normalization+case conflicts")
+
+	c.Files[1].Path = "MENU/CAF\u00c9"
+	assert.NoError(c.AssertNormalizationSafe(), "case-only conflicts are not normalization conflicts")
+	assert.Error(c.AssertCaseInsensitiveSafe())
+
+	c.Files[1].Path = "menu/tea"
+	assert.NoError(c.AssertNormalizationSafe())
+}
+
+func Test_AssertCaseInsensitiveSafeFolding(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &tlc.Container{
+		Files: []*tlc.File{
+			&tlc.File{Path: "straße"},
+			&tlc.File{Path: "STRASSE"},
+		},
+	}
+	assert.Error(c.AssertCaseInsensitiveSafe(), "should use full case folding")
+}
+
+func Test_NormalizePath(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.EqualValues(cafeNFC, tlc.NormalizePath(cafeNFD))
+	assert.EqualValues(cafeNFC, tlc.NormalizePath(cafeNFC))
+
+	f := &tlc.File{Path: cafeNFC}
+	assert.EqualValues(cafeNFC, f.SourcePath())
+	f.OriginalPath = cafeNFD
+	assert.EqualValues(cafeNFD, f.SourcePath())
+}
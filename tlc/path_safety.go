@@ -0,0 +1,83 @@
+package tlc
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ValidatePath returns an error if a container path is unsafe to join
+// with a base path, ie. if it could end up outside of it (zip-slip).
+//
+// It rejects empty paths, absolute paths (Unix-style, Windows drive letters
+// and UNC paths), paths containing NUL bytes, and paths that have empty,
+// "." or ".." components. Backslashes are treated as separators, since
+// they are on Windows.
+func ValidatePath(p string) error {
+	if p == "" {
+		return errors.New("empty path")
+	}
+
+	if strings.IndexByte(p, 0) != -1 {
+		return errors.Errorf("path %q contains a NUL byte", p)
+	}
+
+	if isAbsolutePath(p) {
+		return errors.Errorf("path %q is absolute", p)
+	}
+
+	for _, token := range strings.Split(strings.Replace(p, "\\", "/", -1), "/") {
+		switch token {
+		case "":
+			return errors.Errorf("path %q has an empty component", p)
+		case ".":
+			return errors.Errorf("path %q has a '.' component", p)
+		case "..":
+			return errors.Errorf("path %q has a '..' component", p)
+		}
+	}
+
+	return nil
+}
+
+func isAbsolutePath(p string) bool {
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "\\") {
+		return true
+	}
+
+	// windows drive letters, like C:\ or C:foo
+	if len(p) >= 2 && p[1] == ':' && isASCIILetter(p[0]) {
+		return true
+	}
+
+	return filepath.IsAbs(p)
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// ValidatePaths returns an error if any entry of the container has
+// an unsafe path, as defined by ValidatePath.
+func (container *Container) ValidatePaths() error {
+	report := container.Report((*Container).CheckPaths)
+	return issuesError("Unsafe container, found the following problems:", report.Issues)
+}
+
+// CheckPaths reports entries with unsafe paths, as defined by ValidatePath.
+// Hardlink targets must be safe too.
+func (container *Container) CheckPaths(report *ValidationReport) {
+	container.ForEachEntry(func(e Entry) ForEachOutcome {
+		if err := ValidatePath(e.GetPath()); err != nil {
+			report.Add(SeverityError, IssueUnsafePath, fmt.Sprintf("Unsafe path: %s", err.Error()), e)
+		}
+		if h, ok := e.(*Hardlink); ok {
+			if err := ValidatePath(h.Target); err != nil {
+				report.Add(SeverityError, IssueUnsafePath, fmt.Sprintf("Unsafe hardlink target: %s", err.Error()), e)
+			}
+		}
+		return ForEachContinue
+	})
+}
@@ -0,0 +1,176 @@
+package tlc
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// A Platform is an operating system containers get installed on
+type Platform string
+
+const (
+	PlatformWindows Platform = "windows"
+	PlatformDarwin  Platform = "darwin"
+	PlatformLinux   Platform = "linux"
+)
+
+const (
+	// windowsMaxPath is MAX_PATH, which includes the installation folder
+	// and the terminating null character
+	windowsMaxPath = 260
+	// maxComponentLength is the maximum length of a single file name on
+	// NTFS, APFS, HFS+ and ext4 (in UTF-16 code units on the first three,
+	// in bytes on the last)
+	maxComponentLength = 255
+)
+
+// WindowsInstallDirLength is how many characters of MAX_PATH
+// ValidateForPlatform leaves for the folder containers get installed into
+// on Windows (like "C:\Users\name\AppData\Roaming\itch\apps\Some Game").
+var WindowsInstallDirLength = 100
+
+// windowsMaxContainerPath returns the length container paths must not
+// exceed, so that they still fit in MAX_PATH once joined to an install
+// folder of WindowsInstallDirLength characters
+func windowsMaxContainerPath() int {
+	return windowsMaxPath - 1 - (WindowsInstallDirLength + 1)
+}
+
+// windowsReservedNames can't be used as file names on Windows,
+// even with an extension (CON.txt is just as bad as CON)
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+	"CONIN$": true, "CONOUT$": true,
+}
+
+const windowsInvalidChars = `<>:"|?*\`
+
+// ValidateForPlatform returns an error if the container can't be installed
+// as-is on the given platform. On top of what Validate checks, it looks for:
+//
+//   - reserved names (CON, NUL, COM1, etc.), names ending in dots or
+//     spaces, invalid characters, paths that won't fit in MAX_PATH once
+//     installed (see WindowsInstallDirLength) and symlinks, on Windows
+//   - colons in names, on macOS
+//   - names longer than 255 characters, everywhere
+//   - case conflicts, on Windows and macOS (see AssertCaseInsensitiveSafe)
+//   - normalization conflicts, on macOS (see AssertNormalizationSafe)
+func (container *Container) ValidateForPlatform(platform Platform) error {
+	report, err := container.ReportForPlatform(platform)
+	if err != nil {
+		return err
+	}
+	return issuesError(fmt.Sprintf("Container not portable to %s, found the following problems:", platform), report.Issues)
+}
+
+// ReportForPlatform returns all the issues ValidateForPlatform looks for
+func (container *Container) ReportForPlatform(platform Platform) (*ValidationReport, error) {
+	validators, err := PlatformValidators(platform)
+	if err != nil {
+		return nil, err
+	}
+	return container.Report(validators...), nil
+}
+
+// PlatformValidators returns all validators relevant to a given platform
+func PlatformValidators(platform Platform) ([]Validator, error) {
+	switch platform {
+	case PlatformWindows, PlatformDarwin, PlatformLinux:
+		// good
+	default:
+		return nil, errors.Errorf("unknown platform %q", platform)
+	}
+
+	validators := []Validator{(*Container).CheckDuplicates}
+
+	if platform == PlatformWindows || platform == PlatformDarwin {
+		validators = append(validators, (*Container).CheckCaseConflicts)
+	}
+
+	if platform == PlatformDarwin {
+		validators = append(validators, (*Container).CheckNormalizationConflicts)
+	}
+
+	validators = append(validators, func(c *Container, report *ValidationReport) {
+		c.ForEachEntry(func(e Entry) ForEachOutcome {
+			for _, reason := range portabilityProblems(platform, e) {
+				report.Add(SeverityError, IssueNotPortable, reason, e)
+			}
+			return ForEachContinue
+		})
+	})
+
+	return validators, nil
+}
+
+// portabilityProblems returns a list of reasons why an entry can't
+// be installed on a given platform
+func portabilityProblems(platform Platform, e Entry) []string {
+	var reasons []string
+	entryPath := e.GetPath()
+
+	for _, name := range strings.Split(entryPath, "/") {
+		if platform == PlatformLinux {
+			if len(name) > maxComponentLength {
+				reasons = append(reasons, fmt.Sprintf("Name too long (%d bytes, max %d): %q", len(name), maxComponentLength, name))
+			}
+		} else {
+			if l := utf16Len(name); l > maxComponentLength {
+				reasons = append(reasons, fmt.Sprintf("Name too long (%d characters, max %d): %q", l, maxComponentLength, name))
+			}
+		}
+
+		switch platform {
+		case PlatformWindows:
+			if isWindowsReservedName(name) {
+				reasons = append(reasons, fmt.Sprintf("Reserved name on windows: %q", name))
+			}
+			if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+				reasons = append(reasons, fmt.Sprintf("Name ends with a dot or a space: %q", name))
+			}
+			if i := strings.IndexFunc(name, isWindowsInvalidRune); i != -1 {
+				reasons = append(reasons, fmt.Sprintf("Invalid character %q in name: %q", name[i], name))
+			}
+		case PlatformDarwin:
+			if strings.ContainsRune(name, ':') {
+				reasons = append(reasons, fmt.Sprintf("Invalid character ':' in name: %q", name))
+			}
+		}
+	}
+
+	if platform == PlatformWindows {
+		if l, max := utf16Len(entryPath), windowsMaxContainerPath(); l > max {
+			reasons = append(reasons, fmt.Sprintf("Path too long (%d characters, max %d to fit in MAX_PATH with a %d characters install folder)", l, max, WindowsInstallDirLength))
+		}
+
+		if _, ok := e.(*Symlink); ok {
+			reasons = append(reasons, "Symlinks require special privileges on windows")
+		}
+	}
+
+	return reasons
+}
+
+func isWindowsReservedName(name string) bool {
+	base := name
+	if i := strings.IndexByte(base, '.'); i != -1 {
+		base = base[:i]
+	}
+	base = strings.TrimRight(base, " ")
+	return windowsReservedNames[strings.ToUpper(base)]
+}
+
+func isWindowsInvalidRune(r rune) bool {
+	return r < 32 || strings.ContainsRune(windowsInvalidChars, r)
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
@@ -0,0 +1,83 @@
+package tlc_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValidateForPlatform(t *testing.T) {
+	assert := assert.New(t)
+
+	portable := &tlc.Container{
+		Dirs: []*tlc.Dir{
+			&tlc.Dir{Path: "data", Mode: 0o755 | uint32(os.ModeDir)},
+		},
+		Files: []*tlc.File{
+			&tlc.File{Path: "data/level1.pak", Mode: 0o644},
+			&tlc.File{Path: "game.exe", Mode: 0o755},
+			&tlc.File{Path: "CONSOLE.txt", Mode: 0o644},
+		},
+	}
+	for _, platform := range []tlc.Platform{tlc.PlatformWindows, tlc.PlatformDarwin, tlc.PlatformLinux} {
+		assert.NoError(portable.ValidateForPlatform(platform), "should be portable to %s", platform)
+	}
+
+	assert.Error(portable.ValidateForPlatform("amiga"))
+
+	expectProblem := func(c *tlc.Container, platform tlc.Platform, needle string) {
+		err := c.ValidateForPlatform(platform)
+		if assert.Error(err, "should not be portable to %s", platform) {
+			assert.Contains(err.Error(), needle)
+		}
+	}
+
+	single := func(path string) *tlc.Container {
+		return &tlc.Container{
+			Files: []*tlc.File{
+				&tlc.File{Path: path, Mode: 0o644},
+			},
+		}
+	}
+
+	for _, name := range []string{"CON.txt", "data/nul", "aux", "Com1.log", "lpt9", "CONIN$", "conout$.log"} {
+		expectProblem(single(name), tlc.PlatformWindows, "Reserved name")
+		assert.NoError(single(name).ValidateForPlatform(tlc.PlatformLinux))
+	}
+
+	expectProblem(single("readme."), tlc.PlatformWindows, "ends with a dot or a space")
+	expectProblem(single("data /readme"), tlc.PlatformWindows, "ends with a dot or a space")
+	expectProblem(single("what?.txt"), tlc.PlatformWindows, "Invalid character")
+	expectProblem(single("a:b"), tlc.PlatformWindows, "Invalid character")
+	expectProblem(single("a:b"), tlc.PlatformDarwin, "Invalid character")
+	assert.NoError(single("a:b").ValidateForPlatform(tlc.PlatformLinux))
+
+	expectProblem(single(strings.Repeat("a/", 130)+"b"), tlc.PlatformWindows, "Path too long")
+	// leaves room for the install folder
+	assert.NoError(single(strings.Repeat("a", 158)).ValidateForPlatform(tlc.PlatformWindows))
+	expectProblem(single(strings.Repeat("a", 159)), tlc.PlatformWindows, "Path too long")
+	func() {
+		defer func(length int) { tlc.WindowsInstallDirLength = length }(tlc.WindowsInstallDirLength)
+		tlc.WindowsInstallDirLength = 200
+		expectProblem(single(strings.Repeat("a", 100)), tlc.PlatformWindows, "Path too long")
+	}()
+	expectProblem(single(strings.Repeat("a", 256)), tlc.PlatformLinux, "Name too long")
+	assert.NoError(single(strings.Repeat("é", 200)).ValidateForPlatform(tlc.PlatformDarwin))
+	expectProblem(single(strings.Repeat("é", 200)), tlc.PlatformLinux, "Name too long")
+
+	withLink := single("lib.so.1")
+	withLink.Symlinks = []*tlc.Symlink{
+		&tlc.Symlink{Path: "lib.so", Mode: 0o644 | uint32(os.ModeSymlink), Dest: "lib.so.1"},
+	}
+	expectProblem(withLink, tlc.PlatformWindows, "Symlinks")
+	assert.NoError(withLink.ValidateForPlatform(tlc.PlatformLinux))
+
+	caseConflict := single("Readme.txt")
+	caseConflict.Files = append(caseConflict.Files, &tlc.File{Path: "README.txt", Mode: 0o644})
+	expectProblem(caseConflict, tlc.PlatformDarwin, "Case conflict")
+	expectProblem(caseConflict, tlc.PlatformWindows, "Case conflict")
+	assert.NoError(caseConflict.ValidateForPlatform(tlc.PlatformLinux))
+}
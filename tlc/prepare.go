@@ -1,16 +1,56 @@
 package tlc
 
 import (
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 
 	"github.com/pkg/errors"
 )
 
-// Prepare creates all directories, files, and symlinks.
-// It also applies the proper permissions if the files already exist
+type PrepareOpts struct {
+	// SymlinkPolicy decides what to do with symlinks that escape
+	// the container or loop. When it's not SymlinkPolicyAllow, Prepare
+	// also refuses to write through symlinks already on disk that
+	// resolve outside of basePath.
+	SymlinkPolicy SymlinkPolicy
+
+	// Metadata selects which extended metadata to restore from the
+	// container, see ApplyMetadata. Note that writing to files afterwards
+	// changes their modification time, see fspool.FsPool.Metadata.
+	Metadata MetadataOpts
+}
+
+// Prepare creates all directories, files, symlinks and hardlinks.
+// It also applies the proper permissions if the files already exist.
+// It refuses to do anything if any entry has an unsafe path (see ValidatePath)
 func (c *Container) Prepare(basePath string) error {
-	err := os.MkdirAll(basePath, 0o755)
+	return c.PrepareWithOpts(basePath, PrepareOpts{})
+}
+
+// PrepareWithOpts behaves like Prepare, with additional options
+func (c *Container) PrepareWithOpts(basePath string, opts PrepareOpts) error {
+	err := c.ValidatePaths()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var unsafeLinks map[*Symlink]SymlinkProblem
+	if opts.SymlinkPolicy != SymlinkPolicyAllow {
+		unsafeLinks = c.unsafeSymlinks()
+		if opts.SymlinkPolicy == SymlinkPolicyReject && len(unsafeLinks) > 0 {
+			return errors.WithStack(c.ValidateSymlinks())
+		}
+
+		err = c.assertNoSymlinkEscapes(basePath)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	err = os.MkdirAll(basePath, 0o755)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -29,13 +69,73 @@ func (c *Container) Prepare(basePath string) error {
 		}
 	}
 
+	for _, link := range c.Hardlinks {
+		err := c.PrepareHardlink(basePath, link)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
 	for _, link := range c.Symlinks {
+		if _, unsafe := unsafeLinks[link]; unsafe {
+			switch opts.SymlinkPolicy {
+			case SymlinkPolicySkip:
+				continue
+			case SymlinkPolicyMaterialize:
+				err := c.materializeSymlink(basePath, link)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				continue
+			}
+		}
+
 		err := c.prepareSymlink(basePath, link)
 		if err != nil {
 			return errors.WithStack(err)
 		}
 	}
 
+	if opts.Metadata.any() {
+		err := c.restoreMetadata(basePath, opts.Metadata)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// restoreMetadata applies the metadata of all entries. Directories come
+// last, deepest first, since creating their children changes their mtime.
+func (c *Container) restoreMetadata(basePath string, opts MetadataOpts) error {
+	var entries []Entry
+	for _, f := range c.Files {
+		entries = append(entries, f)
+	}
+	for _, l := range c.Symlinks {
+		entries = append(entries, l)
+	}
+	dirs := append([]*Dir{}, c.Dirs...)
+	sort.Slice(dirs, func(i, j int) bool {
+		return comparePaths(dirs[i].Path, dirs[j].Path) > 0
+	})
+	for _, d := range dirs {
+		entries = append(entries, d)
+	}
+
+	for _, e := range entries {
+		fullPath := filepath.Join(basePath, e.GetPath())
+		if _, err := os.Lstat(fullPath); os.IsNotExist(err) {
+			// skipped symlink
+			continue
+		}
+
+		err := ApplyMetadata(fullPath, e.GetMetadata(), opts)
+		if err != nil {
+			return errors.WithMessage(err, e.GetPath())
+		}
+	}
 	return nil
 }
 
@@ -95,3 +195,72 @@ func (c *Container) prepareSymlink(basePath string, link *Symlink) error {
 
 	return nil
 }
+
+// PrepareHardlink (re)creates a hardlink on disk, pointing to its target.
+// The target needs to exist on disk already.
+func (c *Container) PrepareHardlink(basePath string, link *Hardlink) error {
+	err := ValidatePath(link.Target)
+	if err != nil {
+		return errors.WithMessage(err, "while preparing hardlink")
+	}
+
+	fullPath := filepath.Join(basePath, link.Path)
+	err = os.RemoveAll(fullPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = os.Link(filepath.Join(basePath, link.Target), fullPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// materializeSymlink writes a regular file containing the symlink's
+// destination in place of the symlink
+func (c *Container) materializeSymlink(basePath string, link *Symlink) error {
+	fullPath := filepath.Join(basePath, link.Path)
+	err := os.RemoveAll(fullPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = ioutil.WriteFile(fullPath, []byte(link.Dest), 0o644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// assertNoSymlinkEscapes returns an error if preparing any entry
+// would go through a symlink on disk that leads outside of basePath
+func (c *Container) assertNoSymlinkEscapes(basePath string) error {
+	var err error
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		checkedPath := e.GetPath()
+		switch e.(type) {
+		case *Symlink, *Hardlink:
+			// links get removed before being created, so only
+			// their parents matter
+			checkedPath = path.Dir(checkedPath)
+		}
+
+		var escape string
+		escape, err = FindSymlinkEscape(basePath, checkedPath)
+		if h, ok := e.(*Hardlink); ok && err == nil && escape == "" {
+			// the target must not be reached through a symlink either
+			escape, err = FindSymlinkEscape(basePath, h.Target)
+		}
+		if err == nil && escape != "" {
+			err = errors.Errorf("refusing to prepare (%s): (%s) is a symlink leading outside of (%s)", e.GetPath(), escape, basePath)
+		}
+		if err != nil {
+			return ForEachBreak
+		}
+		return ForEachContinue
+	})
+	return err
+}
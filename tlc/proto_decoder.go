@@ -0,0 +1,169 @@
+package tlc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// protobuf field numbers of Container
+const (
+	containerFieldFiles     = 1
+	containerFieldDirs      = 2
+	containerFieldSymlinks  = 3
+	containerFieldHardlinks = 4
+	containerFieldSize      = 16
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// maxProtoEntrySize is the largest single entry ProtoDecoder accepts
+const maxProtoEntrySize = 64 * 1024 * 1024
+
+// A ProtoDecoder reads a protobuf-encoded Container one entry at a
+// time, so that the whole container never has to be in memory at once.
+// Entries are returned in the order they were encoded in: Marshal
+// writes all files first, then dirs, symlinks and hardlinks.
+type ProtoDecoder struct {
+	r    *bufio.Reader
+	buf  []byte
+	size int64
+	done bool
+}
+
+var _ EntryIterator = (*ProtoDecoder)(nil)
+
+// NewProtoDecoder returns a decoder reading a protobuf-encoded Container from r
+func NewProtoDecoder(r io.Reader) *ProtoDecoder {
+	return &ProtoDecoder{r: bufio.NewReader(r)}
+}
+
+// Size returns the container's size. It's only known once Next
+// has returned io.EOF, since it's encoded after all entries.
+func (d *ProtoDecoder) Size() int64 {
+	return d.size
+}
+
+// Next returns the next entry of the container, or io.EOF
+// if there are none left.
+func (d *ProtoDecoder) Next() (Entry, error) {
+	for !d.done {
+		key, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			if err == io.EOF {
+				d.done = true
+				break
+			}
+			return nil, errors.WithMessage(err, "while decoding container")
+		}
+		field, wireType := key>>3, key&7
+
+		if wireType != wireBytes {
+			v, err := d.readScalar(wireType)
+			if err != nil {
+				return nil, err
+			}
+			if field == containerFieldSize && wireType == wireVarint {
+				d.size = int64(v)
+			}
+			continue
+		}
+
+		payload, err := d.readBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		var e Entry
+		switch field {
+		case containerFieldFiles:
+			e = &File{}
+		case containerFieldDirs:
+			e = &Dir{}
+		case containerFieldSymlinks:
+			e = &Symlink{}
+		case containerFieldHardlinks:
+			e = &Hardlink{}
+		default:
+			// unknown field, skip it
+			continue
+		}
+
+		err = proto.Unmarshal(payload, e.(proto.Message))
+		if err != nil {
+			return nil, errors.WithMessage(err, "while decoding container entry")
+		}
+		return e, nil
+	}
+	return nil, io.EOF
+}
+
+func (d *ProtoDecoder) readScalar(wireType uint64) (uint64, error) {
+	switch wireType {
+	case wireVarint:
+		v, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			return 0, errors.WithMessage(unexpectedEOF(err), "while decoding container")
+		}
+		return v, nil
+	case wireFixed64, wireFixed32:
+		n := 8
+		if wireType == wireFixed32 {
+			n = 4
+		}
+		_, err := d.r.Discard(n)
+		if err != nil {
+			return 0, errors.WithMessage(unexpectedEOF(err), "while decoding container")
+		}
+		return 0, nil
+	}
+	return 0, errors.Errorf("while decoding container: unsupported wire type %d", wireType)
+}
+
+func (d *ProtoDecoder) readBytes() ([]byte, error) {
+	length, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, errors.WithMessage(unexpectedEOF(err), "while decoding container")
+	}
+	if length > maxProtoEntrySize {
+		return nil, errors.Errorf("while decoding container: entry too large (%d bytes)", length)
+	}
+
+	if uint64(cap(d.buf)) < length {
+		d.buf = make([]byte, length)
+	}
+	d.buf = d.buf[:length]
+	_, err = io.ReadFull(d.r, d.buf)
+	if err != nil {
+		return nil, errors.WithMessage(unexpectedEOF(err), "while decoding container")
+	}
+	return d.buf, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ReadCompact reads a protobuf-encoded Container into a CompactContainer
+func ReadCompact(r io.Reader) (*CompactContainer, error) {
+	d := NewProtoDecoder(r)
+	cc := NewCompactContainer()
+	err := cc.AddAll(d)
+	if err != nil {
+		return nil, err
+	}
+	cc.Size = d.Size()
+	return cc, nil
+}
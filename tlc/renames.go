@@ -0,0 +1,153 @@
+package tlc
+
+import (
+	"crypto/sha256"
+	"io"
+	"sort"
+
+	"github.com/itchio/lake"
+	"github.com/pkg/errors"
+)
+
+// A Move is a file that was renamed or moved to another directory,
+// without its contents changing.
+type Move struct {
+	OldPath string `json:"oldPath"`
+	NewPath string `json:"newPath"`
+	Size    int64  `json:"size"`
+}
+
+// Renames lists how entries were reorganized between two containers
+type Renames struct {
+	// CaseFixes are renames that only change the casing of a directory or
+	// file. Like those made by FixExistingCase, directories come first, from
+	// shortest to longest path, and each fix assumes the previous ones have
+	// been applied.
+	CaseFixes []lake.CaseFix `json:"caseFixes,omitempty"`
+	// Moves are files that kept their contents but changed paths. Their
+	// OldPath assumes all CaseFixes have been applied.
+	Moves []Move `json:"moves,omitempty"`
+}
+
+// DetectRenames finds files that were moved or renamed between c1 and c2,
+// by comparing the sizes, and then the contents of files that were removed
+// from c1 and added to c2. pool1 and pool2 must give access to the files of
+// c1 and c2 respectively, and are left open. Empty files are never
+// considered moved.
+func (c1 *Container) DetectRenames(pool1 lake.Pool, c2 *Container, pool2 lake.Pool) (*Renames, error) {
+	res := &Renames{}
+
+	// first, directories that only changed case
+	dirs2 := make(map[string]string)
+	for _, d := range c2.Dirs {
+		dirs2[foldCase(d.Path)] = d.Path
+	}
+	var dirPaths []string
+	for _, d := range c1.Dirs {
+		dirPaths = append(dirPaths, d.Path)
+	}
+	sort.SliceStable(dirPaths, func(i, j int) bool {
+		return len(dirPaths[i]) < len(dirPaths[j])
+	})
+	applyFixes := func(p string) string {
+		for _, fix := range res.CaseFixes {
+			p, _ = fix.Apply(p)
+		}
+		return p
+	}
+	for _, p := range dirPaths {
+		p = applyFixes(p)
+		if newPath, ok := dirs2[foldCase(p)]; ok && newPath != p {
+			res.CaseFixes = append(res.CaseFixes, lake.CaseFix{Old: p, New: newPath})
+		}
+	}
+
+	// then, files that are in c1 but not c2 (and vice versa),
+	// once the case fixes have been applied
+	files2 := make(map[string]int64)
+	for i, f := range c2.Files {
+		files2[f.Path] = int64(i)
+	}
+
+	present1 := make(map[string]bool)
+	removedBySize := make(map[int64][]int64)
+	fixedPaths := make(map[int64]string)
+	for i, f := range c1.Files {
+		fixedPath := applyFixes(f.Path)
+		present1[fixedPath] = true
+		if _, ok := files2[fixedPath]; ok || f.Size == 0 {
+			continue
+		}
+		fixedPaths[int64(i)] = fixedPath
+		removedBySize[f.Size] = append(removedBySize[f.Size], int64(i))
+	}
+
+	hashes1 := make(map[int64]string)
+	used := make(map[int64]bool)
+	for j, f2 := range c2.Files {
+		if present1[f2.Path] {
+			// not added
+			continue
+		}
+		candidates := removedBySize[f2.Size]
+		if f2.Size == 0 || len(candidates) == 0 {
+			continue
+		}
+
+		h2, err := fileHash(pool2, int64(j), f2)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		for _, i := range candidates {
+			if used[i] {
+				continue
+			}
+			h1, ok := hashes1[i]
+			if !ok {
+				h1, err = fileHash(pool1, i, c1.Files[i])
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+				hashes1[i] = h1
+			}
+			if h1 != h2 {
+				continue
+			}
+
+			used[i] = true
+			oldPath := fixedPaths[i]
+			if foldCase(oldPath) == foldCase(f2.Path) {
+				res.CaseFixes = append(res.CaseFixes, lake.CaseFix{Old: oldPath, New: f2.Path})
+			} else {
+				res.Moves = append(res.Moves, Move{OldPath: oldPath, NewPath: f2.Path, Size: f2.Size})
+			}
+			break
+		}
+	}
+
+	return res, nil
+}
+
+// fileHash returns the SHA-256 of a file, using its stored
+// digest if it has one (see ComputeHashes)
+func fileHash(pool lake.Pool, index int64, f *File) (string, error) {
+	if f.Digest != nil && f.Digest.Algorithm == HashAlgorithm_SHA256 {
+		return string(f.Digest.Value), nil
+	}
+	return hashPoolFile(pool, index)
+}
+
+func hashPoolFile(pool lake.Pool, index int64) (string, error) {
+	r, err := pool.GetReader(index)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(h.Sum(nil)), nil
+}
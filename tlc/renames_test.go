@@ -0,0 +1,64 @@
+package tlc_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itchio/lake"
+	"github.com/itchio/lake/pools/fspool"
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DetectRenames(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_renames")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpPath)
+
+	write := func(root string, name string, contents string) {
+		p := filepath.Join(tmpPath, root, filepath.FromSlash(name))
+		assert.NoError(os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NoError(ioutil.WriteFile(p, []byte(contents), 0o644))
+	}
+
+	write("v1", "Data/level1.pak", "level one")
+	write("v1", "Data/level2.pak", "level two")
+	write("v1", "readme.txt", "read me!")
+	write("v1", "old/music.ogg", "la la la")
+	write("v1", "sfx/boom.wav", "boom boom")
+	write("v1", "empty", "")
+
+	// Data => data, readme.txt => README.txt, old/music.ogg => music/theme.ogg,
+	// sfx/boom.wav changed contents, empty moved (but it's empty)
+	write("v2", "data/level1.pak", "level one")
+	write("v2", "data/level2.pak", "level 2!!")
+	write("v2", "README.txt", "read me!")
+	write("v2", "music/theme.ogg", "la la la")
+	write("v2", "sfx/bang.wav", "bang bang")
+	write("v2", "empty2", "")
+
+	c1, err := tlc.WalkDir(filepath.Join(tmpPath, "v1"), tlc.WalkOpts{})
+	assert.NoError(err)
+	c2, err := tlc.WalkDir(filepath.Join(tmpPath, "v2"), tlc.WalkOpts{})
+	assert.NoError(err)
+
+	pool1 := fspool.New(c1, filepath.Join(tmpPath, "v1"))
+	defer pool1.Close()
+	pool2 := fspool.New(c2, filepath.Join(tmpPath, "v2"))
+	defer pool2.Close()
+
+	renames, err := c1.DetectRenames(pool1, c2, pool2)
+	assert.NoError(err)
+
+	assert.EqualValues([]lake.CaseFix{
+		{Old: "Data", New: "data"},
+		{Old: "readme.txt", New: "README.txt"},
+	}, renames.CaseFixes)
+	assert.EqualValues([]tlc.Move{
+		{OldPath: "old/music.ogg", NewPath: "music/theme.ogg", Size: 8},
+	}, renames.Moves)
+}
@@ -0,0 +1,217 @@
+package tlc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type Severity string
+
+const (
+	// SeverityError is for issues that make a container unusable or unsafe
+	SeverityError Severity = "error"
+	// SeverityWarning is for issues that are suspicious, but harmless by themselves
+	SeverityWarning Severity = "warning"
+)
+
+type IssueKind string
+
+const (
+	IssueDuplicate             IssueKind = "duplicate"
+	IssueCaseConflict          IssueKind = "case-conflict"
+	IssueNormalizationConflict IssueKind = "normalization-conflict"
+	IssueUnsafePath            IssueKind = "unsafe-path"
+	IssueUnsafeSymlink         IssueKind = "unsafe-symlink"
+	IssueMissingParent         IssueKind = "missing-parent"
+	IssueOffsetMismatch        IssueKind = "offset-mismatch"
+	IssueNotPortable           IssueKind = "not-portable"
+	IssueBadMode               IssueKind = "bad-mode"
+	IssueBadHardlink           IssueKind = "bad-hardlink"
+)
+
+// A ValidationIssue is a single problem found in a container
+type ValidationIssue struct {
+	Severity Severity  `json:"severity"`
+	Kind     IssueKind `json:"kind"`
+	Message  string    `json:"message"`
+	// Entries are the offending entries. It may be empty, for example
+	// for conflicts between parent directories that aren't listed.
+	Entries []Entry `json:"entries,omitempty"`
+}
+
+func (vi ValidationIssue) ToString() string {
+	lines := []string{vi.Message}
+	for _, e := range vi.Entries {
+		lines = append(lines, e.(humanPrintable).ToString())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// jsonEntry wraps entries so they can be told apart when unmarshalling
+type jsonEntry struct {
+	Type     EntryType `json:"type"`
+	File     *File     `json:"file,omitempty"`
+	Dir      *Dir      `json:"dir,omitempty"`
+	Symlink  *Symlink  `json:"symlink,omitempty"`
+	Hardlink *Hardlink `json:"hardlink,omitempty"`
+}
+
+type jsonIssue struct {
+	Severity Severity    `json:"severity"`
+	Kind     IssueKind   `json:"kind"`
+	Message  string      `json:"message"`
+	Entries  []jsonEntry `json:"entries,omitempty"`
+}
+
+var _ json.Marshaler = ValidationIssue{}
+var _ json.Unmarshaler = (*ValidationIssue)(nil)
+
+func (vi ValidationIssue) MarshalJSON() ([]byte, error) {
+	ji := jsonIssue{
+		Severity: vi.Severity,
+		Kind:     vi.Kind,
+		Message:  vi.Message,
+	}
+	for _, e := range vi.Entries {
+		switch e := e.(type) {
+		case *File:
+			ji.Entries = append(ji.Entries, jsonEntry{Type: EntryTypeFile, File: e})
+		case *Dir:
+			ji.Entries = append(ji.Entries, jsonEntry{Type: EntryTypeDir, Dir: e})
+		case *Symlink:
+			ji.Entries = append(ji.Entries, jsonEntry{Type: EntryTypeSymlink, Symlink: e})
+		case *Hardlink:
+			ji.Entries = append(ji.Entries, jsonEntry{Type: EntryTypeHardlink, Hardlink: e})
+		default:
+			return nil, errors.Errorf("unknown entry type %T", e)
+		}
+	}
+	return json.Marshal(ji)
+}
+
+func (vi *ValidationIssue) UnmarshalJSON(data []byte) error {
+	var ji jsonIssue
+	err := json.Unmarshal(data, &ji)
+	if err != nil {
+		return err
+	}
+
+	*vi = ValidationIssue{
+		Severity: ji.Severity,
+		Kind:     ji.Kind,
+		Message:  ji.Message,
+	}
+	for _, je := range ji.Entries {
+		switch {
+		case je.Type == EntryTypeFile && je.File != nil:
+			vi.Entries = append(vi.Entries, je.File)
+		case je.Type == EntryTypeDir && je.Dir != nil:
+			vi.Entries = append(vi.Entries, je.Dir)
+		case je.Type == EntryTypeSymlink && je.Symlink != nil:
+			vi.Entries = append(vi.Entries, je.Symlink)
+		case je.Type == EntryTypeHardlink && je.Hardlink != nil:
+			vi.Entries = append(vi.Entries, je.Hardlink)
+		default:
+			return errors.Errorf("invalid entry of type %q", je.Type)
+		}
+	}
+	return nil
+}
+
+// A ValidationReport lists all issues found in a container by
+// one or more validators.
+type ValidationReport struct {
+	Issues []ValidationIssue `json:"issues"`
+}
+
+// A Validator looks for a certain kind of issues in a container,
+// and adds them to a report.
+type Validator func(c *Container, report *ValidationReport)
+
+// DefaultValidators are used by Report when no validators are given
+var DefaultValidators = []Validator{
+	(*Container).CheckDuplicates,
+	(*Container).CheckPaths,
+	(*Container).CheckSymlinks,
+	(*Container).CheckConsistency,
+}
+
+// Report runs the given validators (or DefaultValidators) on the container,
+// and returns all the issues they found.
+func (c *Container) Report(validators ...Validator) *ValidationReport {
+	if len(validators) == 0 {
+		validators = DefaultValidators
+	}
+
+	report := &ValidationReport{}
+	for _, v := range validators {
+		v(c, report)
+	}
+	return report
+}
+
+// Add appends an issue to the report
+func (r *ValidationReport) Add(severity Severity, kind IssueKind, message string, entries ...Entry) {
+	r.Issues = append(r.Issues, ValidationIssue{
+		Severity: severity,
+		Kind:     kind,
+		Message:  message,
+		Entries:  entries,
+	})
+}
+
+// Errors returns all issues of severity error
+func (r *ValidationReport) Errors() []ValidationIssue {
+	return r.filter(SeverityError)
+}
+
+// Warnings returns all issues of severity warning
+func (r *ValidationReport) Warnings() []ValidationIssue {
+	return r.filter(SeverityWarning)
+}
+
+func (r *ValidationReport) filter(severity Severity) []ValidationIssue {
+	var res []ValidationIssue
+	for _, issue := range r.Issues {
+		if issue.Severity == severity {
+			res = append(res, issue)
+		}
+	}
+	return res
+}
+
+// HasErrors returns true if any issue has severity error
+func (r *ValidationReport) HasErrors() bool {
+	return len(r.Errors()) > 0
+}
+
+// Err returns an error describing all issues of severity error,
+// or nil if there are none.
+func (r *ValidationReport) Err() error {
+	return issuesError("Invalid container, found the following problems:", r.Errors())
+}
+
+func issuesError(header string, issues []ValidationIssue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+
+	var messages []string
+	for _, issue := range issues {
+		messages = append(messages, issue.ToString())
+	}
+	return errors.New(header + "\n" + strings.Join(messages, "\n\n"))
+}
+
+// Print writes a human-readable version of the report
+func (r *ValidationReport) Print(output WriteLine) {
+	for _, issue := range r.Issues {
+		output(fmt.Sprintf("[%s] %s: %s", issue.Severity, issue.Kind, issue.Message))
+		for _, e := range issue.Entries {
+			output("  " + e.(humanPrintable).ToString())
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package tlc_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Report(t *testing.T) {
+	assert := assert.New(t)
+
+	linkMode := 0o644 | uint32(os.ModeSymlink)
+	c := &tlc.Container{
+		Dirs: []*tlc.Dir{
+			&tlc.Dir{Path: "lib", Mode: 0o755 | uint32(os.ModeDir)},
+		},
+		Files: []*tlc.File{
+			&tlc.File{Path: "lib", Mode: 0o644, Size: 4},
+			&tlc.File{Path: "../evil", Mode: 0o644, Size: 4, Offset: 4},
+		},
+		Symlinks: []*tlc.Symlink{
+			&tlc.Symlink{Path: "a", Mode: linkMode, Dest: "b"},
+			&tlc.Symlink{Path: "b", Mode: linkMode, Dest: "lib"},
+		},
+		Size: 8,
+	}
+
+	report := c.Report()
+	kinds := make(map[tlc.IssueKind]tlc.Severity)
+	for _, issue := range report.Issues {
+		kinds[issue.Kind] = issue.Severity
+	}
+	assert.EqualValues(map[tlc.IssueKind]tlc.Severity{
+		tlc.IssueDuplicate:     tlc.SeverityError,
+		tlc.IssueUnsafePath:    tlc.SeverityError,
+		tlc.IssueUnsafeSymlink: tlc.SeverityWarning,
+	}, kinds)
+
+	assert.True(report.HasErrors())
+	assert.EqualValues(2, len(report.Errors()))
+	assert.EqualValues(1, len(report.Warnings()))
+	report.Print(func(line string) {
+		t.Logf("%s", line)
+	})
+
+	payload, err := json.Marshal(report)
+	assert.NoError(err)
+	t.Logf("JSON: %s", string(payload))
+
+	var decoded tlc.ValidationReport
+	assert.NoError(json.Unmarshal(payload, &decoded))
+	assert.EqualValues(report, &decoded)
+
+	dup := decoded.Issues[0]
+	assert.EqualValues(tlc.IssueDuplicate, dup.Kind)
+	if assert.EqualValues(2, len(dup.Entries)) {
+		assert.IsType(&tlc.File{}, dup.Entries[0])
+		assert.IsType(&tlc.Dir{}, dup.Entries[1])
+	}
+
+	c.Files = c.Files[:0]
+	c.Symlinks = c.Symlinks[:1]
+	c.Size = 0
+	report = c.Report()
+	assert.False(report.HasErrors())
+	assert.NoError(report.Err())
+}
@@ -0,0 +1,248 @@
+package tlc
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxSymlinkHops is the number of symlinks we're willing to follow
+// when resolving a chain, like most kernels do.
+const maxSymlinkHops = 40
+
+type SymlinkProblemKind int
+
+const (
+	// SymlinkEscapes is for symlinks that are absolute, or that
+	// resolve outside of the container root
+	SymlinkEscapes SymlinkProblemKind = 1
+	// SymlinkLoops is for symlinks that never resolve
+	SymlinkLoops SymlinkProblemKind = 2
+	// SymlinkChains is for symlinks that resolve through other symlinks
+	// of the container. They're not unsafe by themselves, but they're
+	// easy to get wrong.
+	SymlinkChains SymlinkProblemKind = 3
+)
+
+func (k SymlinkProblemKind) String() string {
+	switch k {
+	case SymlinkEscapes:
+		return "escapes container"
+	case SymlinkLoops:
+		return "loops"
+	case SymlinkChains:
+		return "chains through other symlinks"
+	}
+	return fmt.Sprintf("SymlinkProblemKind(%d)", int(k))
+}
+
+// A SymlinkProblem describes a symlink that's unsafe or suspicious
+type SymlinkProblem struct {
+	Symlink *Symlink
+	Kind    SymlinkProblemKind
+	// Target is what the symlink resolves to, relative to the container root
+	// (or an absolute path, if it was absolute)
+	Target string
+}
+
+// IsUnsafe returns true if the symlink could be used to write outside
+// of the container, or could not be resolved at all.
+func (sp SymlinkProblem) IsUnsafe() bool {
+	return sp.Kind == SymlinkEscapes || sp.Kind == SymlinkLoops
+}
+
+func (sp SymlinkProblem) ToString() string {
+	return fmt.Sprintf("%s (resolves to %s)\n%s", sp.Kind, sp.Target, sp.Symlink.ToString())
+}
+
+// A SymlinkPolicy decides what to do with unsafe symlinks (see SymlinkProblem.IsUnsafe)
+// when laying out a container on disk. It should be set to something other
+// than SymlinkPolicyAllow when dealing with untrusted content.
+type SymlinkPolicy int
+
+const (
+	// SymlinkPolicyAllow creates all symlinks verbatim
+	SymlinkPolicyAllow SymlinkPolicy = 0
+	// SymlinkPolicyReject refuses to do anything if there are unsafe symlinks
+	SymlinkPolicyReject SymlinkPolicy = 1
+	// SymlinkPolicySkip doesn't create unsafe symlinks
+	SymlinkPolicySkip SymlinkPolicy = 2
+	// SymlinkPolicyMaterialize replaces unsafe symlinks with regular
+	// files containing their destination, like git does on filesystems
+	// without symlink support.
+	SymlinkPolicyMaterialize SymlinkPolicy = 3
+)
+
+// FindSymlinkProblems resolves all symlinks of the container, relative to
+// the container root, and returns those that escape it, loop, or chain
+// through other symlinks.
+func (c *Container) FindSymlinkProblems() []SymlinkProblem {
+	links := make(map[string]*Symlink)
+	for _, s := range c.Symlinks {
+		links[s.Path] = s
+	}
+
+	var problems []SymlinkProblem
+	for _, s := range c.Symlinks {
+		target, hops, escapes := resolveSymlink(links, s)
+		switch {
+		case escapes:
+			problems = append(problems, SymlinkProblem{Symlink: s, Kind: SymlinkEscapes, Target: target})
+		case hops > maxSymlinkHops:
+			problems = append(problems, SymlinkProblem{Symlink: s, Kind: SymlinkLoops, Target: target})
+		case hops > 1:
+			problems = append(problems, SymlinkProblem{Symlink: s, Kind: SymlinkChains, Target: target})
+		}
+	}
+	return problems
+}
+
+// ValidateSymlinks returns an error if any symlink of the container
+// escapes it, loops, or chains through other symlinks.
+func (c *Container) ValidateSymlinks() error {
+	report := c.Report((*Container).CheckSymlinks)
+	return issuesError("Unsafe symlinks, found the following problems:", report.Issues)
+}
+
+// CheckSymlinks reports symlinks that escape the container or loop as errors,
+// and symlinks that chain through other symlinks as warnings.
+func (c *Container) CheckSymlinks(report *ValidationReport) {
+	for _, p := range c.FindSymlinkProblems() {
+		severity := SeverityWarning
+		if p.IsUnsafe() {
+			severity = SeverityError
+		}
+		report.Add(severity, IssueUnsafeSymlink, fmt.Sprintf("Symlink %s (resolves to %s)", p.Kind, p.Target), p.Symlink)
+	}
+}
+
+// unsafeSymlinks returns a set of all unsafe symlinks of the container
+func (c *Container) unsafeSymlinks() map[*Symlink]SymlinkProblem {
+	res := make(map[*Symlink]SymlinkProblem)
+	for _, p := range c.FindSymlinkProblems() {
+		if p.IsUnsafe() {
+			res[p.Symlink] = p
+		}
+	}
+	return res
+}
+
+// resolveSymlink follows s (and any symlink it goes through) and returns
+// its final target, the number of symlinks followed, and whether it
+// ended up outside of the container.
+//
+// Like the kernel does, the destination is walked one component at a time,
+// and symlinks are expanded before any ".." that follows them is applied:
+// "s/.." is the parent of wherever s points to, not the directory s is in.
+func resolveSymlink(links map[string]*Symlink, s *Symlink) (string, int, bool) {
+	dest := strings.Replace(s.Dest, "\\", "/", -1)
+	if isAbsolutePath(dest) {
+		return dest, 1, true
+	}
+	hops := 1
+
+	var current []string
+	pending := append(splitSymlinkPath(path.Dir(s.Path)), splitSymlinkPath(dest)...)
+	for len(pending) > 0 {
+		token := pending[0]
+		pending = pending[1:]
+
+		switch token {
+		case "", ".":
+			continue
+		case "..":
+			if len(current) == 0 {
+				// went above the root, whatever comes next
+				return path.Join(append([]string{".."}, pending...)...), hops, true
+			}
+			current = current[:len(current)-1]
+			continue
+		}
+
+		current = append(current, token)
+		link, ok := links[strings.Join(current, "/")]
+		if !ok {
+			continue
+		}
+
+		hops++
+		if hops > maxSymlinkHops {
+			return path.Join(append(current, pending...)...), hops, false
+		}
+
+		linkDest := strings.Replace(link.Dest, "\\", "/", -1)
+		if isAbsolutePath(linkDest) {
+			return path.Join(append([]string{linkDest}, pending...)...), hops, true
+		}
+		// the destination is relative to the directory the link is in
+		current = current[:len(current)-1]
+		pending = append(splitSymlinkPath(linkDest), pending...)
+	}
+
+	if len(current) == 0 {
+		return ".", hops, false
+	}
+	return strings.Join(current, "/"), hops, false
+}
+
+func splitSymlinkPath(p string) []string {
+	if p == "." {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// FindSymlinkEscape looks at containerPath and all its existing parents on disk,
+// under basePath, and returns the native path of the first one that is
+// a symlink resolving outside of basePath, or an empty string if there
+// are none. This catches symlinks planted by a previous operation, that
+// writes to containerPath would otherwise go through.
+func FindSymlinkEscape(basePath string, containerPath string) (string, error) {
+	realBase, err := filepath.EvalSymlinks(basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// nothing on disk yet, nothing to escape through
+			return "", nil
+		}
+		return "", errors.WithStack(err)
+	}
+
+	tokens := strings.Split(containerPath, "/")
+	current := basePath
+	for _, token := range tokens {
+		if token == "." {
+			continue
+		}
+		current = filepath.Join(current, token)
+
+		stats, err := os.Lstat(current)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return "", nil
+			}
+			return "", errors.WithStack(err)
+		}
+
+		if stats.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		realCurrent, err := filepath.EvalSymlinks(current)
+		if err != nil {
+			// dangling or looping symlink, can't be written through anyway,
+			// but it's certainly not safe.
+			return current, nil
+		}
+
+		rel, err := filepath.Rel(realBase, realCurrent)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return current, nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,128 @@
+package tlc_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/itchio/lake/tlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func symlinkContainer() *tlc.Container {
+	linkMode := 0o644 | uint32(os.ModeSymlink)
+	return &tlc.Container{
+		Dirs: []*tlc.Dir{
+			&tlc.Dir{Path: "game", Mode: 0o755 | uint32(os.ModeDir)},
+			&tlc.Dir{Path: "game/lib", Mode: 0o755 | uint32(os.ModeDir)},
+		},
+		Files: []*tlc.File{
+			&tlc.File{Path: "game/lib/libfoo.so.1", Mode: 0o644},
+		},
+		Symlinks: []*tlc.Symlink{
+			&tlc.Symlink{Path: "game/lib/libfoo.so", Mode: linkMode, Dest: "libfoo.so.1"},
+			&tlc.Symlink{Path: "game/libfoo.so", Mode: linkMode, Dest: "lib/libfoo.so"},
+			&tlc.Symlink{Path: "game/etc", Mode: linkMode, Dest: "/etc"},
+			&tlc.Symlink{Path: "game/up", Mode: linkMode, Dest: "../.."},
+			&tlc.Symlink{Path: "game/sneaky", Mode: linkMode, Dest: "up/home"},
+			&tlc.Symlink{Path: "game/ping", Mode: linkMode, Dest: "pong"},
+			&tlc.Symlink{Path: "game/pong", Mode: linkMode, Dest: "ping"},
+		},
+	}
+}
+
+func Test_FindSymlinkProblems(t *testing.T) {
+	assert := assert.New(t)
+
+	c := symlinkContainer()
+	kinds := make(map[string]tlc.SymlinkProblemKind)
+	for _, p := range c.FindSymlinkProblems() {
+		t.Logf("%s", p.ToString())
+		kinds[p.Symlink.Path] = p.Kind
+	}
+
+	assert.EqualValues(map[string]tlc.SymlinkProblemKind{
+		"game/libfoo.so": tlc.SymlinkChains,
+		"game/etc":       tlc.SymlinkEscapes,
+		"game/up":        tlc.SymlinkEscapes,
+		"game/sneaky":    tlc.SymlinkEscapes,
+		"game/ping":      tlc.SymlinkLoops,
+		"game/pong":      tlc.SymlinkLoops,
+	}, kinds)
+
+	assert.Error(c.ValidateSymlinks())
+
+	c.Symlinks = c.Symlinks[:1]
+	assert.NoError(c.ValidateSymlinks())
+
+	// ".." applies to where a symlink points to, not to where it is
+	linkMode := 0o644 | uint32(os.ModeSymlink)
+	c = &tlc.Container{
+		Symlinks: []*tlc.Symlink{
+			&tlc.Symlink{Path: "x/y/s", Mode: linkMode, Dest: "../.."},
+			&tlc.Symlink{Path: "x/y/a", Mode: linkMode, Dest: "s/../../../z"},
+			&tlc.Symlink{Path: "x/y/b", Mode: linkMode, Dest: "s/x/../z"},
+		},
+	}
+	problems := c.FindSymlinkProblems()
+	if assert.Len(problems, 2) {
+		assert.EqualValues("x/y/a", problems[0].Symlink.Path)
+		assert.EqualValues(tlc.SymlinkEscapes, problems[0].Kind)
+		assert.EqualValues("../../../z", problems[0].Target)
+		assert.EqualValues("x/y/b", problems[1].Symlink.Path)
+		assert.EqualValues(tlc.SymlinkChains, problems[1].Kind)
+		assert.EqualValues("z", problems[1].Target)
+	}
+	assert.Error(c.ValidateSymlinks())
+}
+
+func Test_PrepareSymlinkPolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not tested on windows")
+	}
+
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_symlinkpolicy")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpPath)
+
+	c := symlinkContainer()
+
+	rejectPath := filepath.Join(tmpPath, "reject")
+	err = c.PrepareWithOpts(rejectPath, tlc.PrepareOpts{SymlinkPolicy: tlc.SymlinkPolicyReject})
+	assert.Error(err)
+	_, err = os.Lstat(rejectPath)
+	assert.True(os.IsNotExist(err), "should not have prepared anything")
+
+	skipPath := filepath.Join(tmpPath, "skip")
+	assert.NoError(c.PrepareWithOpts(skipPath, tlc.PrepareOpts{SymlinkPolicy: tlc.SymlinkPolicySkip}))
+	dest, err := os.Readlink(filepath.Join(skipPath, "game", "libfoo.so"))
+	assert.NoError(err)
+	assert.EqualValues("lib/libfoo.so", dest, "should have kept safe symlinks")
+	_, err = os.Lstat(filepath.Join(skipPath, "game", "etc"))
+	assert.True(os.IsNotExist(err), "should have skipped unsafe symlinks")
+
+	materializePath := filepath.Join(tmpPath, "materialize")
+	assert.NoError(c.PrepareWithOpts(materializePath, tlc.PrepareOpts{SymlinkPolicy: tlc.SymlinkPolicyMaterialize}))
+	stats, err := os.Lstat(filepath.Join(materializePath, "game", "etc"))
+	assert.NoError(err)
+	assert.True(stats.Mode().IsRegular(), "should have materialized unsafe symlinks")
+	contents, err := ioutil.ReadFile(filepath.Join(materializePath, "game", "etc"))
+	assert.NoError(err)
+	assert.EqualValues("/etc", string(contents))
+
+	// a symlink planted on disk by a previous operation
+	outside := filepath.Join(tmpPath, "outside")
+	assert.NoError(os.MkdirAll(outside, 0o755))
+	plantedPath := filepath.Join(tmpPath, "planted")
+	assert.NoError(os.MkdirAll(filepath.Join(plantedPath, "game"), 0o755))
+	assert.NoError(os.Symlink(outside, filepath.Join(plantedPath, "game", "lib")))
+
+	err = c.PrepareWithOpts(plantedPath, tlc.PrepareOpts{SymlinkPolicy: tlc.SymlinkPolicySkip})
+	assert.Error(err, "should refuse to write through planted symlinks")
+	_, err = os.Lstat(filepath.Join(outside, "libfoo.so.1"))
+	assert.True(os.IsNotExist(err), "should not have written outside base path")
+}
@@ -13,6 +13,11 @@ It has these top-level messages:
 	Dir
 	File
 	Symlink
+	Hardlink
+	Digest
+	Metadata
+	Ownership
+	Xattr
 */
 package tlc
 
@@ -29,11 +34,36 @@ var _ = math.Inf
 // is compatible with the proto package it is being compiled against.
 const _ = proto.ProtoPackageIsVersion1
 
+type HashAlgorithm int32
+
+const (
+	HashAlgorithm_NONE   HashAlgorithm = 0
+	HashAlgorithm_SHA256 HashAlgorithm = 1
+	HashAlgorithm_SHA1   HashAlgorithm = 2
+)
+
+var HashAlgorithm_name = map[int32]string{
+	0: "NONE",
+	1: "SHA256",
+	2: "SHA1",
+}
+var HashAlgorithm_value = map[string]int32{
+	"NONE":   0,
+	"SHA256": 1,
+	"SHA1":   2,
+}
+
+func (x HashAlgorithm) String() string {
+	return proto.EnumName(HashAlgorithm_name, int32(x))
+}
+func (HashAlgorithm) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
 type Container struct {
-	Files    []*File    `protobuf:"bytes,1,rep,name=files" json:"files,omitempty"`
-	Dirs     []*Dir     `protobuf:"bytes,2,rep,name=dirs" json:"dirs,omitempty"`
-	Symlinks []*Symlink `protobuf:"bytes,3,rep,name=symlinks" json:"symlinks,omitempty"`
-	Size     int64      `protobuf:"varint,16,opt,name=size" json:"size,omitempty"`
+	Files     []*File     `protobuf:"bytes,1,rep,name=files" json:"files,omitempty"`
+	Dirs      []*Dir      `protobuf:"bytes,2,rep,name=dirs" json:"dirs,omitempty"`
+	Symlinks  []*Symlink  `protobuf:"bytes,3,rep,name=symlinks" json:"symlinks,omitempty"`
+	Hardlinks []*Hardlink `protobuf:"bytes,4,rep,name=hardlinks" json:"hardlinks,omitempty"`
+	Size      int64       `protobuf:"varint,16,opt,name=size" json:"size,omitempty"`
 }
 
 func (m *Container) Reset()                    { *m = Container{} }
@@ -62,9 +92,17 @@ func (m *Container) GetSymlinks() []*Symlink {
 	return nil
 }
 
+func (m *Container) GetHardlinks() []*Hardlink {
+	if m != nil {
+		return m.Hardlinks
+	}
+	return nil
+}
+
 type Dir struct {
-	Path string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
-	Mode uint32 `protobuf:"varint,2,opt,name=mode" json:"mode,omitempty"`
+	Path     string    `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Mode     uint32    `protobuf:"varint,2,opt,name=mode" json:"mode,omitempty"`
+	Metadata *Metadata `protobuf:"bytes,3,opt,name=metadata" json:"metadata,omitempty"`
 }
 
 func (m *Dir) Reset()                    { *m = Dir{} }
@@ -72,11 +110,21 @@ func (m *Dir) String() string            { return proto.CompactTextString(m) }
 func (*Dir) ProtoMessage()               {}
 func (*Dir) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
 
+func (m *Dir) GetMetadata() *Metadata {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
 type File struct {
-	Path   string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
-	Mode   uint32 `protobuf:"varint,2,opt,name=mode" json:"mode,omitempty"`
-	Size   int64  `protobuf:"varint,3,opt,name=size" json:"size,omitempty"`
-	Offset int64  `protobuf:"varint,4,opt,name=offset" json:"offset,omitempty"`
+	Path         string    `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Mode         uint32    `protobuf:"varint,2,opt,name=mode" json:"mode,omitempty"`
+	Size         int64     `protobuf:"varint,3,opt,name=size" json:"size,omitempty"`
+	Offset       int64     `protobuf:"varint,4,opt,name=offset" json:"offset,omitempty"`
+	OriginalPath string    `protobuf:"bytes,5,opt,name=original_path,json=originalPath" json:"original_path,omitempty"`
+	Digest       *Digest   `protobuf:"bytes,6,opt,name=digest" json:"digest,omitempty"`
+	Metadata     *Metadata `protobuf:"bytes,7,opt,name=metadata" json:"metadata,omitempty"`
 }
 
 func (m *File) Reset()                    { *m = File{} }
@@ -84,10 +132,25 @@ func (m *File) String() string            { return proto.CompactTextString(m) }
 func (*File) ProtoMessage()               {}
 func (*File) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
 
+func (m *File) GetDigest() *Digest {
+	if m != nil {
+		return m.Digest
+	}
+	return nil
+}
+
+func (m *File) GetMetadata() *Metadata {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
 type Symlink struct {
-	Path string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
-	Mode uint32 `protobuf:"varint,2,opt,name=mode" json:"mode,omitempty"`
-	Dest string `protobuf:"bytes,3,opt,name=dest" json:"dest,omitempty"`
+	Path     string    `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Mode     uint32    `protobuf:"varint,2,opt,name=mode" json:"mode,omitempty"`
+	Dest     string    `protobuf:"bytes,3,opt,name=dest" json:"dest,omitempty"`
+	Metadata *Metadata `protobuf:"bytes,4,opt,name=metadata" json:"metadata,omitempty"`
 }
 
 func (m *Symlink) Reset()                    { *m = Symlink{} }
@@ -95,29 +158,134 @@ func (m *Symlink) String() string            { return proto.CompactTextString(m)
 func (*Symlink) ProtoMessage()               {}
 func (*Symlink) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
+func (m *Symlink) GetMetadata() *Metadata {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+type Hardlink struct {
+	Path     string    `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Mode     uint32    `protobuf:"varint,2,opt,name=mode" json:"mode,omitempty"`
+	Target   string    `protobuf:"bytes,3,opt,name=target" json:"target,omitempty"`
+	Metadata *Metadata `protobuf:"bytes,4,opt,name=metadata" json:"metadata,omitempty"`
+}
+
+func (m *Hardlink) Reset()                    { *m = Hardlink{} }
+func (m *Hardlink) String() string            { return proto.CompactTextString(m) }
+func (*Hardlink) ProtoMessage()               {}
+func (*Hardlink) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *Hardlink) GetMetadata() *Metadata {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+type Digest struct {
+	Algorithm HashAlgorithm `protobuf:"varint,1,opt,name=algorithm,enum=io.itch.wharf.tlc.HashAlgorithm" json:"algorithm,omitempty"`
+	Value     []byte        `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *Digest) Reset()                    { *m = Digest{} }
+func (m *Digest) String() string            { return proto.CompactTextString(m) }
+func (*Digest) ProtoMessage()               {}
+func (*Digest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+type Metadata struct {
+	Mtime  int64      `protobuf:"varint,1,opt,name=mtime" json:"mtime,omitempty"`
+	Owner  *Ownership `protobuf:"bytes,2,opt,name=owner" json:"owner,omitempty"`
+	Xattrs []*Xattr   `protobuf:"bytes,3,rep,name=xattrs" json:"xattrs,omitempty"`
+}
+
+func (m *Metadata) Reset()                    { *m = Metadata{} }
+func (m *Metadata) String() string            { return proto.CompactTextString(m) }
+func (*Metadata) ProtoMessage()               {}
+func (*Metadata) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *Metadata) GetOwner() *Ownership {
+	if m != nil {
+		return m.Owner
+	}
+	return nil
+}
+
+func (m *Metadata) GetXattrs() []*Xattr {
+	if m != nil {
+		return m.Xattrs
+	}
+	return nil
+}
+
+type Ownership struct {
+	Uid uint32 `protobuf:"varint,1,opt,name=uid" json:"uid,omitempty"`
+	Gid uint32 `protobuf:"varint,2,opt,name=gid" json:"gid,omitempty"`
+}
+
+func (m *Ownership) Reset()                    { *m = Ownership{} }
+func (m *Ownership) String() string            { return proto.CompactTextString(m) }
+func (*Ownership) ProtoMessage()               {}
+func (*Ownership) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+type Xattr struct {
+	Name  string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Value []byte `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *Xattr) Reset()                    { *m = Xattr{} }
+func (m *Xattr) String() string            { return proto.CompactTextString(m) }
+func (*Xattr) ProtoMessage()               {}
+func (*Xattr) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
 func init() {
 	proto.RegisterType((*Container)(nil), "io.itch.wharf.tlc.Container")
 	proto.RegisterType((*Dir)(nil), "io.itch.wharf.tlc.Dir")
 	proto.RegisterType((*File)(nil), "io.itch.wharf.tlc.File")
 	proto.RegisterType((*Symlink)(nil), "io.itch.wharf.tlc.Symlink")
+	proto.RegisterType((*Hardlink)(nil), "io.itch.wharf.tlc.Hardlink")
+	proto.RegisterType((*Digest)(nil), "io.itch.wharf.tlc.Digest")
+	proto.RegisterType((*Metadata)(nil), "io.itch.wharf.tlc.Metadata")
+	proto.RegisterType((*Ownership)(nil), "io.itch.wharf.tlc.Ownership")
+	proto.RegisterType((*Xattr)(nil), "io.itch.wharf.tlc.Xattr")
+	proto.RegisterEnum("io.itch.wharf.tlc.HashAlgorithm", HashAlgorithm_name, HashAlgorithm_value)
 }
 
 var fileDescriptor0 = []byte{
-	// 253 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x94, 0x91, 0xcf, 0x4a, 0x03, 0x31,
-	0x10, 0xc6, 0x89, 0xd9, 0x56, 0x3b, 0x52, 0xd0, 0x1c, 0x6a, 0xf0, 0x54, 0xf6, 0xb4, 0x08, 0x8d,
-	0xa0, 0xe0, 0x03, 0xf8, 0xef, 0x01, 0xe2, 0xad, 0xb7, 0xb5, 0x9b, 0x65, 0x07, 0xb7, 0x9b, 0x92,
-	0x04, 0x44, 0x1f, 0xcb, 0x27, 0x74, 0x32, 0x2d, 0xf5, 0x60, 0x0f, 0x7a, 0x58, 0xf8, 0x76, 0xbe,
-	0x5f, 0xbe, 0xf9, 0x42, 0x60, 0x9a, 0xfa, 0xd5, 0x35, 0x7d, 0x66, 0x13, 0x7c, 0xf2, 0xea, 0x1c,
-	0xbd, 0xc1, 0xb4, 0xea, 0xcc, 0x7b, 0x57, 0x87, 0xd6, 0x90, 0x51, 0x7e, 0x09, 0x98, 0x3c, 0xf8,
-	0x21, 0xd5, 0x38, 0xb8, 0xa0, 0x16, 0x30, 0x6a, 0xb1, 0x77, 0x51, 0x8b, 0xb9, 0xac, 0x4e, 0x6f,
-	0x2e, 0xcc, 0xaf, 0x03, 0xe6, 0x99, 0x7c, 0xbb, 0xa5, 0xd4, 0x15, 0x14, 0x0d, 0x86, 0xa8, 0x8f,
-	0x98, 0x9e, 0x1d, 0xa0, 0x1f, 0x31, 0x58, 0x66, 0xd4, 0x1d, 0x9c, 0xc4, 0x8f, 0x75, 0x8f, 0xc3,
-	0x5b, 0xd4, 0x92, 0xf9, 0xcb, 0x03, 0xfc, 0xcb, 0x16, 0xb1, 0x7b, 0x56, 0x29, 0x28, 0x22, 0x7e,
-	0x3a, 0x7d, 0x36, 0x17, 0x95, 0xb4, 0xac, 0xcb, 0x05, 0x48, 0x0a, 0xce, 0xd6, 0xa6, 0x4e, 0x1d,
-	0x95, 0x15, 0xd5, 0xc4, 0xb2, 0xce, 0xb3, 0xb5, 0x6f, 0x1c, 0x55, 0x12, 0xd5, 0xd4, 0xb2, 0x2e,
-	0x97, 0x50, 0xe4, 0xd6, 0x7f, 0xe5, 0xf7, 0x2b, 0xe5, 0xcf, 0x4a, 0x35, 0x83, 0xb1, 0x6f, 0xdb,
-	0xe8, 0x92, 0x2e, 0x78, 0xba, 0xfb, 0x2b, 0x9f, 0xe0, 0x78, 0xd7, 0xf9, 0x3f, 0xf1, 0x8d, 0x8b,
-	0x89, 0xe3, 0x89, 0xcb, 0xfa, 0x7e, 0xb4, 0x94, 0x74, 0xfd, 0xd7, 0x31, 0xbf, 0xd3, 0xed, 0x77,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0xe6, 0x40, 0x7f, 0x6b, 0xb8, 0x01, 0x00, 0x00,
+	// 535 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x94, 0xcd, 0x8e, 0xd3, 0x30,
+	0x10, 0xc7, 0x71, 0xf3, 0xb1, 0xcd, 0xec, 0x16, 0x15, 0x0b, 0x15, 0xf3, 0x71, 0x88, 0xc2, 0xa5,
+	0x5a, 0x89, 0x94, 0x16, 0xb1, 0x88, 0x0b, 0x52, 0x61, 0x41, 0xbd, 0xb0, 0x8b, 0xdc, 0x0b, 0xe2,
+	0x00, 0x32, 0x8d, 0xdb, 0x58, 0x38, 0x49, 0xe5, 0x78, 0x59, 0xe0, 0xc0, 0x05, 0x89, 0x97, 0x45,
+	0xbc, 0x03, 0xb2, 0x93, 0xb4, 0x5a, 0x08, 0xd2, 0x76, 0x6f, 0x33, 0xe3, 0xdf, 0xcc, 0xfc, 0x67,
+	0xec, 0x04, 0x7a, 0x5a, 0x2e, 0x46, 0x5a, 0x2e, 0xe2, 0xb5, 0x2a, 0x74, 0x81, 0x6f, 0x88, 0x22,
+	0x16, 0x7a, 0x91, 0xc6, 0xe7, 0x29, 0x53, 0xcb, 0x58, 0xcb, 0x45, 0xf4, 0x1b, 0x41, 0xf0, 0xa2,
+	0xc8, 0x35, 0x13, 0x39, 0x57, 0xf8, 0x01, 0x78, 0x4b, 0x21, 0x79, 0x49, 0x50, 0xe8, 0x0c, 0xf7,
+	0x27, 0xb7, 0xe2, 0x7f, 0x12, 0xe2, 0x57, 0x42, 0x72, 0x5a, 0x51, 0xf8, 0x10, 0xdc, 0x44, 0xa8,
+	0x92, 0x74, 0x2c, 0x3d, 0x68, 0xa1, 0x8f, 0x85, 0xa2, 0x96, 0xc1, 0x47, 0xd0, 0x2d, 0xbf, 0x66,
+	0x52, 0xe4, 0x9f, 0x4a, 0xe2, 0x58, 0xfe, 0x4e, 0x0b, 0x3f, 0xaf, 0x10, 0xba, 0x61, 0xf1, 0x53,
+	0x08, 0x52, 0xa6, 0x92, 0x2a, 0xd1, 0xb5, 0x89, 0x77, 0x5b, 0x12, 0x67, 0x35, 0x43, 0xb7, 0x34,
+	0xc6, 0xe0, 0x96, 0xe2, 0x1b, 0x27, 0xfd, 0x10, 0x0d, 0x1d, 0x6a, 0xed, 0x68, 0x09, 0xce, 0xb1,
+	0x50, 0xe6, 0x68, 0xcd, 0x74, 0x4a, 0x50, 0x88, 0x86, 0x01, 0xb5, 0xb6, 0x89, 0x65, 0x45, 0xc2,
+	0x49, 0x27, 0x44, 0xc3, 0x1e, 0xb5, 0x36, 0x7e, 0x02, 0xdd, 0x8c, 0x6b, 0x96, 0x30, 0xcd, 0x88,
+	0x13, 0xa2, 0xff, 0x34, 0x7f, 0x5d, 0x23, 0x74, 0x03, 0x47, 0xbf, 0x10, 0xb8, 0x66, 0x55, 0x97,
+	0xee, 0xd4, 0x88, 0x75, 0xb6, 0x62, 0xf1, 0x00, 0xfc, 0x62, 0xb9, 0x2c, 0xb9, 0x26, 0xae, 0x8d,
+	0xd6, 0x1e, 0xbe, 0x0f, 0xbd, 0x42, 0x89, 0x95, 0xc8, 0x99, 0xfc, 0x60, 0x8b, 0x7b, 0xb6, 0xf8,
+	0x41, 0x13, 0x7c, 0x63, 0x9a, 0x8c, 0xc1, 0x4f, 0xc4, 0x8a, 0x97, 0x9a, 0xf8, 0x56, 0xf8, 0xed,
+	0xd6, 0xeb, 0x31, 0x00, 0xad, 0xc1, 0x0b, 0xd3, 0xee, 0xed, 0x32, 0xed, 0x77, 0xd8, 0xab, 0x6f,
+	0x6e, 0x97, 0x79, 0x13, 0x23, 0xce, 0xa9, 0xb8, 0xe4, 0xef, 0xfe, 0xee, 0x2e, 0xfd, 0x7f, 0x20,
+	0xe8, 0x36, 0x2f, 0xe0, 0xd2, 0x0a, 0x06, 0xe0, 0x6b, 0xa6, 0x56, 0xbc, 0xd1, 0x50, 0x7b, 0x57,
+	0x57, 0xf1, 0x1e, 0xfc, 0x6a, 0xa1, 0xf8, 0x19, 0x04, 0x4c, 0xae, 0x0a, 0x25, 0x74, 0x9a, 0x59,
+	0x1d, 0xd7, 0x27, 0x61, 0xeb, 0xa3, 0x2d, 0xd3, 0x69, 0xc3, 0xd1, 0x6d, 0x0a, 0xbe, 0x09, 0xde,
+	0x67, 0x26, 0xcf, 0x2a, 0xbd, 0x07, 0xb4, 0x72, 0xa2, 0x9f, 0x08, 0xba, 0x4d, 0x5b, 0x83, 0x64,
+	0x5a, 0x64, 0xdc, 0x96, 0x77, 0x68, 0xe5, 0xe0, 0x09, 0x78, 0xc5, 0x79, 0xce, 0x95, 0x4d, 0xdc,
+	0x9f, 0xdc, 0x6b, 0x69, 0x7a, 0x6a, 0xce, 0xcb, 0x54, 0xac, 0x69, 0x85, 0xe2, 0x87, 0xe0, 0x7f,
+	0x61, 0x5a, 0xab, 0xe6, 0xbb, 0x24, 0x2d, 0x49, 0x6f, 0x0d, 0x40, 0x6b, 0x2e, 0x1a, 0x41, 0xb0,
+	0xa9, 0x82, 0xfb, 0xe0, 0x9c, 0x89, 0xc4, 0xca, 0xe8, 0x51, 0x63, 0x9a, 0xc8, 0x4a, 0x24, 0xf5,
+	0xae, 0x8d, 0x19, 0x8d, 0xc1, 0xb3, 0x15, 0xcc, 0x3d, 0xe4, 0xac, 0x16, 0x1d, 0x50, 0x6b, 0xb7,
+	0x0f, 0x7b, 0x38, 0x82, 0xde, 0x85, 0xf5, 0xe0, 0x2e, 0xb8, 0x27, 0xa7, 0x27, 0x2f, 0xfb, 0xd7,
+	0x30, 0x80, 0x3f, 0x9f, 0x4d, 0x27, 0x8f, 0x8f, 0xfa, 0xc8, 0x44, 0xe7, 0xb3, 0xe9, 0xb8, 0xdf,
+	0x79, 0xee, 0xbd, 0x73, 0xb4, 0x5c, 0x7c, 0xf4, 0xed, 0xaf, 0xee, 0xd1, 0x9f, 0x01, 0x00, 0x60,
+	0xe5, 0xb9, 0x9b, 0xfb, 0x04, 0x00, 0x00,
 }
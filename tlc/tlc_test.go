@@ -1,12 +1,14 @@
 package tlc
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"testing"
 
@@ -72,6 +74,106 @@ func Test_WalkZip(t *testing.T) {
 	assert.Equal(t, totalSize, container.Size, "should report correct size")
 
 	must(t, container.EnsureEqual(zipContainer))
+
+	must(t, container.Report((*Container).CheckConsistency).Err())
+	must(t, zipContainer.Report((*Container).CheckConsistency).Err())
+
+	for i, dir := range []string{"foo", "foo/dir_a", "foo/dir_b"} {
+		assert.Equal(t, dir, zipContainer.Dirs[i].Path, "zip dirs should be sorted")
+	}
+}
+
+func Test_WalkZipNoDirEntries(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("a/b/c.txt")
+	must(t, err)
+	_, err = w.Write([]byte("nested"))
+	must(t, err)
+	must(t, zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	must(t, err)
+
+	container, err := WalkZip(zr, WalkOpts{})
+	must(t, err)
+	must(t, container.Report().Err())
+
+	var dirs []string
+	for _, d := range container.Dirs {
+		dirs = append(dirs, d.Path)
+	}
+	assert.EqualValues(t, []string{"a", "a/b"}, dirs)
+}
+
+func Test_WalkZipUnsafe(t *testing.T) {
+	for _, name := range []string{"../../.bashrc", "/etc/passwd", "foo/../../bar"} {
+		buf := new(bytes.Buffer)
+		zw := zip.NewWriter(buf)
+		w, err := zw.Create(name)
+		must(t, err)
+		_, err = w.Write([]byte("evil"))
+		must(t, err)
+		must(t, zw.Close())
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		must(t, err)
+
+		_, err = WalkZip(zr, WalkOpts{})
+		assert.Error(t, err, "should refuse zip entry %q", name)
+	}
+}
+
+func Test_WalkNormalizationConflicts(t *testing.T) {
+	nfd := "cafe\u0301"
+	nfc := "caf\u00e9"
+
+	walkZip := func(names ...string) error {
+		buf := new(bytes.Buffer)
+		zw := zip.NewWriter(buf)
+		for _, name := range names {
+			w, err := zw.Create(name)
+			must(t, err)
+			_, err = w.Write([]byte("menu"))
+			must(t, err)
+		}
+		must(t, zw.Close())
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		must(t, err)
+
+		_, err = WalkZip(zr, WalkOpts{NormalizeUnicode: true})
+		return err
+	}
+
+	assert.NoError(t, walkZip(nfd+"/a.txt", nfd+"/b.txt"))
+	assert.NoError(t, walkZip(nfd+"/a.txt", nfd+"/", "other.txt"))
+
+	err := walkZip(nfd+"/a.txt", nfc+"/b.txt")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cafe\\u0301")
+		assert.Contains(t, err.Error(), "caf\\u00e9")
+	}
+	assert.Error(t, walkZip("menu/"+nfc, "menu/"+nfd))
+
+	if runtime.GOOS == "darwin" {
+		t.Skip("macOS filesystems normalize paths themselves")
+	}
+
+	tmpPath, err := ioutil.TempDir("", "walk_normalization")
+	must(t, err)
+	defer os.RemoveAll(tmpPath)
+
+	must(t, ioutil.WriteFile(filepath.Join(tmpPath, nfd), []byte("menu"), 0o644))
+	_, err = WalkDir(tmpPath, WalkOpts{NormalizeUnicode: true})
+	assert.NoError(t, err)
+
+	must(t, ioutil.WriteFile(filepath.Join(tmpPath, nfc), []byte("menu"), 0o644))
+	_, err = WalkDir(tmpPath, WalkOpts{NormalizeUnicode: true})
+	assert.Error(t, err)
+
+	_, err = WalkDir(tmpPath, WalkOpts{})
+	assert.NoError(t, err)
 }
 
 func Test_Walk(t *testing.T) {
@@ -217,6 +319,73 @@ func Test_WalkIgnore(t *testing.T) {
 	verifyContainer(container)
 }
 
+func Test_WalkEntryFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_entry_filter")
+	must(t, err)
+	defer os.RemoveAll(tmpPath)
+
+	must(t, os.MkdirAll(filepath.Join(tmpPath, "build", "tmp"), 0o755))
+	must(t, ioutil.WriteFile(filepath.Join(tmpPath, "build", "tmp", "garbage"), []byte{0x1}, 0o644))
+	must(t, os.MkdirAll(filepath.Join(tmpPath, "assets", "tmp"), 0o755))
+	must(t, ioutil.WriteFile(filepath.Join(tmpPath, "assets", "tmp", "keep.txt"), []byte{0x2}, 0o644))
+	must(t, ioutil.WriteFile(filepath.Join(tmpPath, "assets", "huge.bin"), make([]byte, 1024), 0o644))
+	must(t, ioutil.WriteFile(filepath.Join(tmpPath, "assets", "cache"), []byte{0x3}, 0o644))
+	must(t, os.MkdirAll(filepath.Join(tmpPath, "cache"), 0o755))
+	must(t, ioutil.WriteFile(filepath.Join(tmpPath, "cache", "index"), []byte{0x4}, 0o644))
+	must(t, os.MkdirAll(filepath.Join(tmpPath, ".git"), 0o755))
+
+	var asked []string
+	walkOpts := WalkOpts{
+		Filter: PresetFilter,
+		EntryFilter: func(entry *FilterEntry) FilterResult {
+			asked = append(asked, entry.Path)
+			switch {
+			case entry.Path == "build/tmp":
+				return FilterIgnore
+			case entry.Type == EntryTypeFile && entry.Size > 512:
+				return FilterIgnore
+			case entry.Type == EntryTypeDir && entry.Name() == "cache":
+				assert.True(entry.Mode.IsDir())
+				return FilterIgnore
+			}
+			return FilterKeep
+		},
+	}
+
+	verifyContainer := func(container *Container) {
+		var paths []string
+		container.ForEachEntry(func(e Entry) ForEachOutcome {
+			paths = append(paths, e.GetPath())
+			return ForEachContinue
+		})
+		sort.Strings(paths)
+		assert.EqualValues([]string{"assets", "assets/cache", "assets/tmp", "assets/tmp/keep.txt", "build"}, paths)
+		assert.NotContains(asked, "build/tmp/garbage")
+		assert.NotContains(asked, "cache/index")
+		assert.NotContains(asked, ".git")
+	}
+
+	container, err := WalkDir(tmpPath, walkOpts)
+	must(t, err)
+	verifyContainer(container)
+
+	archiveDir, err := ioutil.TempDir("", "tmp_entry_filter_archive")
+	must(t, err)
+	defer os.RemoveAll(archiveDir)
+
+	archive, err := os.Create(filepath.Join(archiveDir, "archive.zip"))
+	must(t, err)
+	must(t, compressZip(archive, tmpPath, &state.Consumer{}))
+	must(t, archive.Close())
+
+	asked = nil
+	container, err = WalkAny(archive.Name(), walkOpts)
+	must(t, err)
+	verifyContainer(container)
+}
+
 func Test_Prepare(t *testing.T) {
 	tmpPath := mktestdir(t, "prepare")
 	defer os.RemoveAll(tmpPath)
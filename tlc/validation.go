@@ -1,12 +1,5 @@
 package tlc
 
-import (
-	"fmt"
-	"strings"
-
-	"github.com/pkg/errors"
-)
-
 type humanPrintable interface {
 	ToString() string
 }
@@ -14,15 +7,16 @@ type humanPrintable interface {
 // Validate verifies that the container doesn't contain wildly invalid
 // stuff, like a directory and a file having the same name
 func (container *Container) Validate() error {
-	paths := make(map[string]humanPrintable)
+	report := container.Report((*Container).CheckDuplicates)
+	return issuesError("Invalid container, found the following problems:", report.Issues)
+}
 
-	type errorBuffer struct {
-		errors []string
-	}
-	buf := errorBuffer{}
+// CheckDuplicates reports entries that have the same path
+func (container *Container) CheckDuplicates(report *ValidationReport) {
+	paths := make(map[string]Entry)
 
-	dup := func(a humanPrintable, b humanPrintable) {
-		buf.errors = append(buf.errors, fmt.Sprintf("Two entries have the same name:\n%s\n%s", a.ToString(), b.ToString()))
+	dup := func(a Entry, b Entry) {
+		report.Add(SeverityError, IssueDuplicate, "Two entries have the same name:", a, b)
 	}
 
 	for _, curr := range container.Files {
@@ -39,15 +33,17 @@ func (container *Container) Validate() error {
 		paths[curr.Path] = curr
 	}
 
-	for _, curr := range container.Dirs {
+	for _, curr := range container.Hardlinks {
 		if previous, ok := paths[curr.Path]; ok {
 			dup(previous, curr)
 		}
 		paths[curr.Path] = curr
 	}
 
-	if len(buf.errors) > 0 {
-		return errors.New("Invalid container, found the following problems:\n" + strings.Join(buf.errors, "\n\n"))
+	for _, curr := range container.Dirs {
+		if previous, ok := paths[curr.Path]; ok {
+			dup(previous, curr)
+		}
+		paths[curr.Path] = curr
 	}
-	return nil
 }
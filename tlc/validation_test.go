@@ -1,7 +1,9 @@
 package tlc_test
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/itchio/lake/tlc"
@@ -47,3 +49,66 @@ func Test_Validate(t *testing.T) {
 	assert.Error(err)
 	t.Logf("As expected:\n%s", err)
 }
+
+func Test_ValidatePath(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, p := range []string{
+		"foo",
+		"foo/bar",
+		"foo/..bar",
+		"foo/bar..",
+		"...",
+		"Sample.app/Contents/MacOS/Sample",
+	} {
+		assert.NoError(tlc.ValidatePath(p), "%q should be safe", p)
+	}
+
+	for _, p := range []string{
+		"",
+		"/etc/passwd",
+		"\\\\server\\share",
+		"C:\\Windows",
+		"c:foo",
+		"../../.bashrc",
+		"foo/../../bar",
+		"foo\\..\\..\\bar",
+		"foo//bar",
+		"foo/",
+		"./foo",
+		"foo\x00bar",
+	} {
+		assert.Error(tlc.ValidatePath(p), "%q should be unsafe", p)
+	}
+}
+
+func Test_ValidatePaths(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &tlc.Container{
+		Files: []*tlc.File{
+			&tlc.File{Path: "foo/bar", Mode: 0o644},
+		},
+		Dirs: []*tlc.Dir{
+			&tlc.Dir{Path: "foo", Mode: 0o755 | uint32(os.ModeDir)},
+		},
+	}
+	assert.NoError(c.ValidatePaths())
+
+	c.Symlinks = append(c.Symlinks, &tlc.Symlink{
+		Path: "../.bashrc",
+		Mode: 0o644 | uint32(os.ModeSymlink),
+		Dest: "/tmp/evil",
+	})
+	err := c.ValidatePaths()
+	assert.Error(err)
+	t.Logf("As expected:\n%s", err)
+
+	tmpPath, err := ioutil.TempDir("", "tmp_validatepaths")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpPath)
+
+	assert.Error(c.Prepare(filepath.Join(tmpPath, "base")), "Prepare should refuse unsafe containers")
+	_, err = os.Lstat(filepath.Join(tmpPath, ".bashrc"))
+	assert.True(os.IsNotExist(err), "Prepare should not have written outside base path")
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/itchio/arkive/zip"
@@ -60,15 +61,44 @@ var baseIgnoredPaths = []string{
 // PresetFilter is a base filter that ignores git/hg/svn metadata,
 // some macOS and Windows metadata, and the `.itch` folder
 var PresetFilter FilterFunc = func(name string) FilterResult {
-	for _, pattern := range baseIgnoredPaths {
-		match, _ := filepath.Match(pattern, name)
-		if match {
-			return FilterIgnore
-		}
+	if _, ok := presetPattern(name); ok {
+		return FilterIgnore
 	}
 	return FilterKeep
 }
 
+// PresetEntryFilter is PresetFilter, as an EntryFilterFunc
+var PresetEntryFilter = PresetFilter.Entries()
+
+// A FilterEntry describes an entry an EntryFilterFunc is asked about
+type FilterEntry struct {
+	// Path is the entry's container path, like "build/tmp"
+	Path string
+	Type EntryType
+	// Size is only set for files
+	Size int64
+	// Mode is the mode the entry would be stored with
+	Mode os.FileMode
+}
+
+// Name returns the last component of the entry's path
+func (fe *FilterEntry) Name() string {
+	return path.Base(fe.Path)
+}
+
+// An EntryFilterFunc is like a FilterFunc, but it's given the entry's
+// full path, type, size and mode. When a directory is ignored, all its
+// children are, too, without the filter being asked about them.
+type EntryFilterFunc func(entry *FilterEntry) FilterResult
+
+// Entries adapts a FilterFunc into an EntryFilterFunc that
+// only looks at entry names
+func (f FilterFunc) Entries() EntryFilterFunc {
+	return func(entry *FilterEntry) FilterResult {
+		return f(entry.Name())
+	}
+}
+
 type WalkOpts struct {
 	// "Wrapping" solves the problem where we're walking:
 	// /foo/bar/Sample.app
@@ -82,11 +112,91 @@ type WalkOpts struct {
 	// only contained `Sample.app`, and nothing else.
 	WrappedDir string
 
-	// Filter decides which files to exclude from the walk
+	// Filter decides which files to exclude from the walk, by name
 	Filter FilterFunc
 
+	// EntryFilter decides which files to exclude from the walk, by path,
+	// type, size and mode. If both Filter and EntryFilter are set, entries
+	// ignored by either of them are excluded.
+	EntryFilter EntryFilterFunc
+
+	// IgnoreRules are gitignore-style rules that exclude entries on top
+	// of Filter and EntryFilter, see IgnoreRules.
+	IgnoreRules *IgnoreRules
+
+	// IgnoreFiles makes WalkDir read ignore files (named IgnoreFileName)
+	// in every directory it walks. Their rules are relative to that
+	// directory, and take precedence over IgnoreRules and the rules of
+	// ignore files in parent directories. Ignore files themselves are
+	// excluded from the container.
+	IgnoreFiles bool
+
+	// Ignored, if non-nil, is filled with the entries excluded from
+	// the walk, and the reason why each of them was.
+	Ignored *IgnoreReport
+
 	// Dereference walks symlinks as if they were their targets
 	Dereference bool
+
+	// NormalizeUnicode converts all paths to NFC (see NormalizePath), which
+	// is useful for builds made on macOS. Files whose path changed record
+	// the path they were found at in OriginalPath. Walks fail if two
+	// entries only differ by their normalization form.
+	NormalizeUnicode bool
+
+	// Metadata selects which extended metadata (modification times,
+	// ownership, extended attributes) to capture. WalkZip only
+	// supports modification times and ownership.
+	Metadata MetadataOpts
+
+	// DetectHardlinks records files that share their device and inode with
+	// a file walked earlier as Hardlinks to it, instead of as copies.
+	// Only supported on Linux and macOS.
+	DetectHardlinks bool
+}
+
+// normalizePath returns the path an entry should be stored at, and
+// the path it was found at if they're different
+func (opts *WalkOpts) normalizePath(entryPath string) (string, string) {
+	if !opts.NormalizeUnicode {
+		return entryPath, ""
+	}
+
+	normalized := NormalizePath(entryPath)
+	if normalized == entryPath {
+		return entryPath, ""
+	}
+	return normalized, entryPath
+}
+
+// normalizedPaths remembers the path each normalized path was found at,
+// so that walks can refuse entries whose paths only differ by their
+// Unicode normalization form. It's nil unless NormalizeUnicode is set.
+type normalizedPaths map[string]string
+
+func (opts *WalkOpts) newNormalizedPaths() normalizedPaths {
+	if !opts.NormalizeUnicode {
+		return nil
+	}
+	return make(normalizedPaths)
+}
+
+// check records that normalized was found at originalPath ("" if it
+// was found as-is), and returns an error if it was already found elsewhere
+func (np normalizedPaths) check(normalized string, originalPath string) error {
+	if np == nil {
+		return nil
+	}
+
+	found := originalPath
+	if found == "" {
+		found = normalized
+	}
+	if previous, ok := np[normalized]; ok && previous != found {
+		return errors.Errorf("(%+q) and (%+q) both normalize to (%+q)", previous, found, normalized)
+	}
+	np[normalized] = found
+	return nil
 }
 
 func (opts *WalkOpts) GetFilter() FilterFunc {
@@ -96,6 +206,43 @@ func (opts *WalkOpts) GetFilter() FilterFunc {
 	return KeepAllFilter
 }
 
+// GetEntryFilter returns an EntryFilterFunc that combines
+// Filter, EntryFilter and IgnoreRules
+func (opts *WalkOpts) GetEntryFilter() EntryFilterFunc {
+	explain := opts.explainer(opts.IgnoreRules)
+	return func(entry *FilterEntry) FilterResult {
+		if explain(entry) != nil {
+			return FilterIgnore
+		}
+		return FilterKeep
+	}
+}
+
+// explainer combines Filter and EntryFilter with the given ignore rules
+// instead of opts.IgnoreRules: the returned func tells why an entry is
+// ignored by any of them, or returns nil if it's kept.
+func (opts *WalkOpts) explainer(ignores *IgnoreRules) func(entry *FilterEntry) *IgnoreReason {
+	byName, byEntry := opts.Filter, opts.EntryFilter
+	return func(entry *FilterEntry) *IgnoreReason {
+		if byName != nil && byName(entry.Name()) == FilterIgnore {
+			if pattern, ok := presetPattern(entry.Name()); ok {
+				return &IgnoreReason{Kind: IgnoredByPreset, Rule: pattern}
+			}
+			return &IgnoreReason{Kind: IgnoredByFilter}
+		}
+		if byEntry != nil && byEntry(entry) == FilterIgnore {
+			return &IgnoreReason{Kind: IgnoredByEntryFilter}
+		}
+		if ignores != nil {
+			rule := ignores.Match(entry.Path, entry.Type == EntryTypeDir)
+			if rule != nil && !rule.Negate {
+				return &IgnoreReason{Kind: IgnoredByRule, Rule: rule.String()}
+			}
+		}
+		return nil
+	}
+}
+
 // Wrap the container path if it's a directory, and it ends in .app
 func (opts *WalkOpts) AutoWrap(containerPathPtr *string, consumer *state.Consumer) {
 	if !opts.normalizeContainerPath(containerPathPtr) {
@@ -208,13 +355,75 @@ func WalkSingle(file eos.File) (*Container, error) {
 
 // WalkDir retrieves information on all files, directories, and symlinks in a directory
 func WalkDir(basePathIn string, opts WalkOpts) (*Container, error) {
-	filter := opts.GetFilter()
+	container := &Container{}
+	size, err := walkDir(basePathIn, opts, func(e Entry) {
+		switch e := e.(type) {
+		case *Dir:
+			container.Dirs = append(container.Dirs, e)
+		case *File:
+			container.Files = append(container.Files, e)
+		case *Symlink:
+			container.Symlinks = append(container.Symlinks, e)
+		case *Hardlink:
+			container.Hardlinks = append(container.Hardlinks, e)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	container.Size = size
+	return container, nil
+}
 
-	var Dirs []*Dir
-	var Symlinks []*Symlink
-	var Files []*File
+// WalkDirCompact is like WalkDir, but returns a CompactContainer,
+// never holding all entries in memory at once.
+func WalkDirCompact(basePathIn string, opts WalkOpts) (*CompactContainer, error) {
+	cc := NewCompactContainer()
+	size, err := walkDir(basePathIn, opts, cc.Add)
+	if err != nil {
+		return nil, err
+	}
+	cc.Size = size
+	return cc, nil
+}
+
+// walkDir calls emit with all entries it finds in a directory,
+// and returns their total size
+func walkDir(basePathIn string, opts WalkOpts, emit func(e Entry)) (int64, error) {
+	// rules from ignore files are added as they're found
+	ignores := &IgnoreRules{}
+	if opts.IgnoreRules != nil {
+		ignores.Append(opts.IgnoreRules)
+	}
+	explain := opts.explainer(ignores)
+
+	// readIgnoreFile adds the rules of the ignore file in a directory, if any
+	readIgnoreFile := func(FullPath string, Path string) error {
+		if !opts.IgnoreFiles {
+			return nil
+		}
+		IgnorePath := filepath.Join(FullPath, IgnoreFileName)
+		if _, err := os.Stat(IgnorePath); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return errors.WithStack(err)
+		}
+
+		rules, err := ReadIgnoreFile(IgnorePath, Path)
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules.Rules {
+			rule.Source = path.Join(Path, IgnoreFileName)
+		}
+		ignores.Append(rules)
+		return nil
+	}
 
 	currentlyWalking := make(map[string]bool)
+	seenFiles := make(map[fileID]string)
+	normalized := opts.newNormalizedPaths()
 
 	TotalOffset := int64(0)
 
@@ -242,6 +451,9 @@ func WalkDir(basePathIn string, opts WalkOpts) (*Container, error) {
 			Path = filepath.ToSlash(Path)
 			if Path == "." {
 				// Don't store a single folder named "."
+				if fileInfo.IsDir() {
+					return readIgnoreFile(FullPath, "")
+				}
 				return nil
 			}
 
@@ -285,21 +497,61 @@ func WalkDir(basePathIn string, opts WalkOpts) (*Container, error) {
 			// don't end up with files we (the patcher) can't modify
 			Mode := fileInfo.Mode() | ModeMask
 
-			if filter(fileInfo.Name()) == FilterIgnore {
+			Path, OriginalPath := opts.normalizePath(Path)
+
+			fe := filterEntryOf(Path, Mode, fileInfo.Size())
+			reason := explain(fe)
+			if reason == nil && opts.IgnoreFiles && Mode.IsRegular() && path.Base(Path) == IgnoreFileName {
+				reason = &IgnoreReason{Kind: IgnoredIgnoreFile}
+			}
+			if reason != nil {
+				if opts.Ignored != nil {
+					if Mode.IsDir() {
+						fe.Size = dirSize(FullPath)
+					}
+					opts.Ignored.add(fe, reason)
+				}
 				if Mode.IsDir() {
 					return filepath.SkipDir
 				}
 				return nil
 			}
 
+			err = normalized.check(Path, OriginalPath)
+			if err != nil {
+				return errors.WithMessage(err, "while walking")
+			}
+
 			if Mode.IsDir() {
-				Dirs = append(Dirs, &Dir{Path: Path, Mode: uint32(Mode)})
+				err := readIgnoreFile(FullPath, Path)
+				if err != nil {
+					return err
+				}
+			}
+
+			Meta, err := opts.Metadata.capture(FullPath, fileInfo, opts.Dereference)
+			if err != nil {
+				return errors.WithMessage(err, Path)
+			}
+
+			if Mode.IsDir() {
+				emit(&Dir{Path: Path, Mode: uint32(Mode), Metadata: Meta})
 			} else if Mode.IsRegular() {
+				if opts.DetectHardlinks {
+					if ID, ok := hardlinkID(fileInfo); ok {
+						if Target, ok := seenFiles[ID]; ok {
+							emit(&Hardlink{Path: Path, Mode: uint32(Mode), Target: Target, Metadata: Meta})
+							return nil
+						}
+						seenFiles[ID] = Path
+					}
+				}
+
 				Size := fileInfo.Size()
 				Offset := TotalOffset
 				OffsetEnd := Offset + Size
 
-				Files = append(Files, &File{Path: Path, Mode: uint32(Mode), Size: Size, Offset: Offset})
+				emit(&File{Path: Path, Mode: uint32(Mode), Size: Size, Offset: Offset, OriginalPath: OriginalPath, Metadata: Meta})
 				TotalOffset = OffsetEnd
 			} else if Mode&os.ModeSymlink > 0 {
 				Dest, err := os.Readlink(FullPath)
@@ -308,7 +560,7 @@ func WalkDir(basePathIn string, opts WalkOpts) (*Container, error) {
 				}
 
 				Dest = filepath.ToSlash(Dest)
-				Symlinks = append(Symlinks, &Symlink{Path: Path, Mode: uint32(Mode), Dest: Dest})
+				emit(&Symlink{Path: Path, Mode: uint32(Mode), Dest: Dest, Metadata: Meta})
 			}
 
 			return nil
@@ -320,16 +572,16 @@ func WalkDir(basePathIn string, opts WalkOpts) (*Container, error) {
 	} else {
 		basePathIn, err := filepath.Abs(basePathIn)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return 0, errors.WithStack(err)
 		}
 
 		fi, err := os.Lstat(basePathIn)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return 0, errors.WithStack(err)
 		}
 
 		if !fi.IsDir() {
-			return nil, errors.Errorf("can't walk non-directory %s", basePathIn)
+			return 0, errors.Errorf("can't walk non-directory %s", basePathIn)
 		}
 
 		baseName := "."
@@ -341,18 +593,37 @@ func WalkDir(basePathIn string, opts WalkOpts) (*Container, error) {
 		currentlyWalking[basePathIn] = true
 		err = filepath.Walk(basePathIn, makeEntryCallback(basePathIn, baseName))
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return 0, errors.WithStack(err)
 		}
 	}
 
-	container := &Container{Size: TotalOffset, Dirs: Dirs, Symlinks: Symlinks, Files: Files}
-	return container, nil
+	return TotalOffset, nil
 }
 
-// WalkZip walks all file in a zip archive and returns a container
-// Note: WalkZip does not respect filter
+// filterEntryOf returns what filters are told about an entry
+func filterEntryOf(entryPath string, mode os.FileMode, size int64) *FilterEntry {
+	fe := &FilterEntry{Path: entryPath, Mode: mode}
+	switch {
+	case mode.IsDir():
+		fe.Type = EntryTypeDir
+	case mode&os.ModeSymlink > 0:
+		fe.Type = EntryTypeSymlink
+	default:
+		fe.Type = EntryTypeFile
+		fe.Size = size
+	}
+	return fe
+}
+
+// WalkZip walks all file in a zip archive and returns a container.
+// Filters are asked about every directory an entry is in, even
+// if the archive has no entry for it.
 func WalkZip(zr *zip.Reader, opts WalkOpts) (*Container, error) {
-	filter := opts.GetFilter()
+	explain := opts.explainer(opts.IgnoreRules)
+	report := opts.Ignored
+	if report == nil {
+		report = &IgnoreReport{}
+	}
 
 	if opts.Dereference {
 		return nil, errors.New("Dereference is not supporting when walking a zip")
@@ -363,31 +634,93 @@ func WalkZip(zr *zip.Reader, opts WalkOpts) (*Container, error) {
 	var Files []*File
 
 	dirMap := make(map[string]os.FileMode)
+	dirMetadata := make(map[string]*Metadata)
+	ignoredDirs := make(map[string]bool)
+	normalized := opts.newNormalizedPaths()
 
 	TotalOffset := int64(0)
 
 eachFile:
 	for _, file := range zr.File {
 		fileName := filepath.ToSlash(filepath.Clean(filepath.ToSlash(file.Name)))
+		if fileName == "." {
+			// some archivers store an entry for the root directory
+			continue
+		}
+
+		err := ValidatePath(fileName)
+		if err != nil {
+			return nil, errors.WithMessage(err, "while walking zip")
+		}
 
-		for _, token := range strings.Split(fileName, "/") {
-			if filter(token) == FilterIgnore {
+		fileName, originalName := opts.normalizePath(fileName)
+
+		info := file.FileInfo()
+		mode := file.Mode() | ModeMask
+
+		fe := filterEntryOf(fileName, mode, int64(file.UncompressedSize64))
+
+		for _, parent := range parentPaths(fileName) {
+			ignored, ok := ignoredDirs[parent]
+			if !ok {
+				dirMode, ok := dirMap[parent]
+				if !ok {
+					dirMode = os.FileMode(0o755) | os.ModeDir
+				}
+				parentEntry := filterEntryOf(parent, dirMode, 0)
+				if reason := explain(parentEntry); reason != nil {
+					report.add(parentEntry, reason)
+					ignored = true
+				}
+				ignoredDirs[parent] = ignored
+			}
+			if ignored {
+				report.addSize(parent, fe.Size)
 				continue eachFile
 			}
 		}
+		if ignoredDirs[fileName] {
+			// the directory's entry comes after its contents,
+			// which already got it ignored
+			continue
+		}
+		if reason := explain(fe); reason != nil {
+			report.add(fe, reason)
+			if info.IsDir() {
+				ignoredDirs[fileName] = true
+			}
+			continue
+		}
+
+		if normalized != nil {
+			// parent directories count too, and normalization
+			// doesn't change the number of path components
+			originalParts := strings.Split(originalName, "/")
+			for _, dir := range append(parentPaths(fileName), fileName) {
+				originalDir := ""
+				if originalName != "" {
+					originalDir = strings.Join(originalParts[:strings.Count(dir, "/")+1], "/")
+				}
+				err := normalized.check(dir, originalDir)
+				if err != nil {
+					return nil, errors.WithMessage(err, "while walking zip")
+				}
+			}
+		}
 
 		// don't trust zip files to have directory entries for
 		// all directories. it's a miracle anything works.
-		dir := path.Dir(fileName)
-		if dir != "" && dir != "." && dirMap[dir] == 0 {
-			dirMap[dir] = os.FileMode(0o755)
+		for _, dir := range parentPaths(fileName) {
+			if dirMap[dir] == 0 {
+				dirMap[dir] = os.FileMode(0o755) | os.ModeDir
+			}
 		}
 
-		info := file.FileInfo()
-		mode := file.Mode() | ModeMask
+		metadata := opts.Metadata.captureZip(&file.FileHeader)
 
 		if info.IsDir() {
 			dirMap[fileName] = mode
+			dirMetadata[fileName] = metadata
 		} else if mode&os.ModeSymlink > 0 {
 			var linkname []byte
 
@@ -410,18 +743,21 @@ eachFile:
 			}
 
 			Symlinks = append(Symlinks, &Symlink{
-				Path: fileName,
-				Dest: string(linkname),
-				Mode: uint32(mode),
+				Path:     fileName,
+				Dest:     string(linkname),
+				Mode:     uint32(mode),
+				Metadata: metadata,
 			})
 		} else {
 			Size := int64(file.UncompressedSize64)
 
 			Files = append(Files, &File{
-				Path:   fileName,
-				Mode:   uint32(mode),
-				Size:   Size,
-				Offset: TotalOffset,
+				Path:         fileName,
+				Mode:         uint32(mode),
+				Size:         Size,
+				Offset:       TotalOffset,
+				OriginalPath: originalName,
+				Metadata:     metadata,
 			})
 
 			TotalOffset += Size
@@ -430,11 +766,17 @@ eachFile:
 
 	for dirPath, dirMode := range dirMap {
 		Dirs = append(Dirs, &Dir{
-			Path: dirPath,
-			Mode: uint32(dirMode),
+			Path:     dirPath,
+			Mode:     uint32(dirMode),
+			Metadata: dirMetadata[dirPath],
 		})
 	}
 
+	// map iteration order is random, but containers should be deterministic
+	sort.Slice(Dirs, func(i, j int) bool {
+		return comparePaths(Dirs[i].Path, Dirs[j].Path) < 0
+	})
+
 	container := &Container{
 		Size:     TotalOffset,
 		Dirs:     Dirs,
@@ -446,8 +788,12 @@ eachFile:
 
 // Stats return a human-readable summary of the contents of a container
 func (container *Container) Stats() string {
-	return fmt.Sprintf("%d files, %d dirs, %d symlinks",
+	res := fmt.Sprintf("%d files, %d dirs, %d symlinks",
 		len(container.Files), len(container.Dirs), len(container.Symlinks))
+	if len(container.Hardlinks) > 0 {
+		res += fmt.Sprintf(", %d hardlinks", len(container.Hardlinks))
+	}
+	return res
 }
 
 var _ fmt.Formatter = (*Container)(nil)
@@ -463,7 +809,7 @@ func (container *Container) Format(f fmt.State, c rune) {
 // IsSingleFile returns true if the container contains
 // exactly one files, and no directories or symlinks.
 func (container *Container) IsSingleFile() bool {
-	if len(container.Files) == 1 && len(container.Dirs) == 0 && len(container.Symlinks) == 0 {
+	if len(container.Files) == 1 && len(container.Dirs) == 0 && len(container.Symlinks) == 0 && len(container.Hardlinks) == 0 {
 		return true
 	}
 	return false
@@ -0,0 +1,108 @@
+package tlc
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// toYAML returns what WriteYAML encodes
+func (c *Container) toYAML() *jsonContainer {
+	jc := &jsonContainer{
+		Size:      &c.Size,
+		Dirs:      []*jsonDir{},
+		Files:     []*jsonFile{},
+		Symlinks:  []*jsonSymlink{},
+		Hardlinks: []*jsonHardlink{},
+	}
+	c.ForEachEntry(func(e Entry) ForEachOutcome {
+		switch je := toJSONEntry(e).(type) {
+		case *jsonDir:
+			jc.Dirs = append(jc.Dirs, je)
+		case *jsonFile:
+			jc.Files = append(jc.Files, je)
+		case *jsonSymlink:
+			jc.Symlinks = append(jc.Symlinks, je)
+		case *jsonHardlink:
+			jc.Hardlinks = append(jc.Hardlinks, je)
+		}
+		return ForEachContinue
+	})
+	return jc
+}
+
+// fromYAML builds a container from what ReadYAML decoded,
+// without validating it
+func fromYAML(jc *jsonContainer) (*Container, error) {
+	c2 := &Container{}
+	add := func(je interface{ toEntry() (Entry, error) }) error {
+		e, err := je.toEntry()
+		if err != nil {
+			return err
+		}
+		c2.addEntry(e)
+		return nil
+	}
+	for _, jd := range jc.Dirs {
+		if err := add(jd); err != nil {
+			return nil, err
+		}
+	}
+	for _, jf := range jc.Files {
+		if err := add(jf); err != nil {
+			return nil, err
+		}
+	}
+	for _, js := range jc.Symlinks {
+		if err := add(js); err != nil {
+			return nil, err
+		}
+	}
+	for _, jh := range jc.Hardlinks {
+		if err := add(jh); err != nil {
+			return nil, err
+		}
+	}
+
+	if jc.Size != nil && *jc.Size != c2.Size {
+		return nil, errors.Errorf("container size is %d, but its files add up to %d", *jc.Size, c2.Size)
+	}
+	return c2, nil
+}
+
+// WriteYAML writes the container as YAML, using the same field names
+// and formats as WriteJSON.
+//
+// Like for JSON (see WriteJSON), WriteYAML and ReadYAML are the supported
+// YAML format: Container doesn't implement yaml.Marshaler, so encoding it
+// with a YAML package directly gives its protobuf fields and decimal modes.
+func (c *Container) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	err := enc.Encode(c.toYAML())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(enc.Close())
+}
+
+// ReadYAML parses the output of WriteYAML, and returns an error
+// if the container has any issues of severity error (see Report).
+func ReadYAML(r io.Reader) (*Container, error) {
+	var jc jsonContainer
+	err := yaml.NewDecoder(r).Decode(&jc)
+	if err != nil {
+		return nil, errors.WithMessage(err, "while decoding container")
+	}
+
+	c, err := fromYAML(&jc)
+	if err != nil {
+		return nil, errors.WithMessage(err, "while decoding container")
+	}
+
+	err = c.Report().Err()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}